@@ -0,0 +1,154 @@
+// Copyright 2020 Humility AI Incorporated, All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hdbscan
+
+import "errors"
+
+// Assign labels every point in data with the cluster of an already-Run
+// Clustering, returning a new Clustering holding the result. The original
+// Clustering (and the data it was trained on) is left untouched, so it can
+// be reused for further Assign calls.
+//
+// The labeling strategy depends on which builder options were set before
+// Run: Voronoi assigns by nearest centroid, NearestNeighbor (optionally
+// widened to outliers via OutlierClustering) assigns by nearest already
+// labeled point, and otherwise nearest centroid is used as the default.
+func (c *Clustering) Assign(data [][]float64) (*Clustering, error) {
+	if len(c.Clusters) == 0 {
+		return nil, errors.New("clustering has not been run yet")
+	}
+
+	result := &Clustering{
+		data:               data,
+		minimumClusterSize: c.minimumClusterSize,
+		distanceFunc:       c.distanceFunc,
+	}
+
+	for _, cluster := range c.Clusters {
+		result.Clusters = append(result.Clusters, &Cluster{id: cluster.id, Centroid: cluster.Centroid})
+	}
+
+	switch {
+	case c.nearestNeighbor:
+		c.assignByNearestNeighbor(data, result)
+	default:
+		if len(c.Clusters[0].Centroid) == 0 {
+			for i, cluster := range c.Clusters {
+				result.Clusters[i].Centroid = centroidOf(cluster.Points, c.data)
+			}
+		}
+		c.assignByCentroid(data, result)
+	}
+
+	return result, nil
+}
+
+func (c *Clustering) assignByCentroid(data [][]float64, result *Clustering) {
+	for i, point := range data {
+		best := 0
+		bestDistance := c.distanceFunc.Func(point, result.Clusters[0].Centroid)
+		for j, cluster := range result.Clusters[1:] {
+			d := c.distanceFunc.Func(point, cluster.Centroid)
+			if d < bestDistance {
+				best = j + 1
+				bestDistance = d
+			}
+		}
+		result.Clusters[best].Points = append(result.Clusters[best].Points, i)
+	}
+}
+
+func (c *Clustering) assignByNearestNeighbor(data [][]float64, result *Clustering) {
+	clusterOf := make([]int, len(c.data))
+	for i := range clusterOf {
+		clusterOf[i] = -1
+	}
+	for ci, cluster := range c.Clusters {
+		for _, p := range cluster.Points {
+			clusterOf[p] = ci
+		}
+		if c.outlierClustering {
+			for _, p := range cluster.Outliers {
+				clusterOf[p] = ci
+			}
+		}
+	}
+
+	// The persisted HNSW index or VP-tree already covers every point in
+	// c.data, so it can only be reused directly here if every one of those
+	// points is labeled: otherwise its nearest hit might be an excluded
+	// outlier.
+	if c.hnswGraph != nil && !clusterOfHasGaps(clusterOf) {
+		for i, point := range data {
+			neighbors := c.hnswGraph.Search(point, 1, c.hnswEfSearch)
+			if len(neighbors) == 0 {
+				continue
+			}
+			ci := clusterOf[neighbors[0].ID]
+			result.Clusters[ci].Points = append(result.Clusters[ci].Points, i)
+		}
+		return
+	}
+	if c.vpTree != nil && !clusterOfHasGaps(clusterOf) {
+		for i, point := range data {
+			neighbors := c.vpTree.kNearest(point, 1, -1)
+			if len(neighbors) == 0 {
+				continue
+			}
+			ci := clusterOf[neighbors[0].point]
+			result.Clusters[ci].Points = append(result.Clusters[ci].Points, i)
+		}
+		return
+	}
+
+	type labeled struct {
+		point     []float64
+		clusterID int
+	}
+
+	var reference []labeled
+	for p, ci := range clusterOf {
+		if ci >= 0 {
+			reference = append(reference, labeled{point: c.data[p], clusterID: ci})
+		}
+	}
+
+	for i, point := range data {
+		if len(reference) == 0 {
+			continue
+		}
+
+		best := 0
+		bestDistance := c.distanceFunc.Func(point, reference[0].point)
+		for j := 1; j < len(reference); j++ {
+			d := c.distanceFunc.Func(point, reference[j].point)
+			if d < bestDistance {
+				best = j
+				bestDistance = d
+			}
+		}
+		ci := reference[best].clusterID
+		result.Clusters[ci].Points = append(result.Clusters[ci].Points, i)
+	}
+}
+
+func clusterOfHasGaps(clusterOf []int) bool {
+	for _, ci := range clusterOf {
+		if ci < 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,260 @@
+// Copyright 2020 Humility AI Incorporated, All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package hdbscan implements the HDBSCAN density-based clustering
+// algorithm: hierarchical single-linkage clustering over a mutual
+// reachability graph, condensed and flattened into the most stable set of
+// clusters.
+package hdbscan
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/NunoSempere/hdbscan/hnsw"
+)
+
+// Cluster is a single flat cluster produced by a Clustering run.
+type Cluster struct {
+	id       int
+	Points   []int
+	Outliers []int
+	Centroid []float64
+	variance float64
+	score    float64
+}
+
+// Clustering holds both the configuration and the resulting state of an
+// HDBSCAN run over a dataset.
+type Clustering struct {
+	data               [][]float64
+	minimumClusterSize int
+	distanceFunc       DistanceFunc
+	minTree            bool
+	verbose            bool
+	logger             *log.Logger
+	subsampleSize      int
+	outlierDetection   bool
+	nearestNeighbor    bool
+	outlierClustering  bool
+	voronoi            bool
+	vpTreeIndex        bool
+	vpTree             *vpTree
+	hnswIndex          bool
+	hnswM              int
+	hnswEfConstruction int
+	hnswEfSearch       int
+	hnswGraph          *hnsw.Graph
+
+	Clusters []*Cluster
+}
+
+// NewClustering creates a Clustering ready to be configured and Run over
+// data. minimumClusterSize must be at least 2, since a "cluster" of a
+// single point is meaningless.
+func NewClustering(data [][]float64, minimumClusterSize int) (*Clustering, error) {
+	if len(data) == 0 {
+		return nil, errors.New("data cannot be empty")
+	}
+	if minimumClusterSize < 2 {
+		return nil, errors.New("minimumClusterSize must be at least 2")
+	}
+
+	return &Clustering{
+		data:               data,
+		minimumClusterSize: minimumClusterSize,
+		distanceFunc:       EuclideanDistance,
+	}, nil
+}
+
+// Verbose enables progress logging to stderr during Run.
+func (c *Clustering) Verbose() *Clustering {
+	c.verbose = true
+	c.logger = log.New(os.Stderr, "hdbscan: ", log.LstdFlags)
+	return c
+}
+
+// Subsample restricts clustering to n evenly spaced points from the
+// original data set, which is useful for very large data sets. Assign can
+// later be used to label the rest of the data against the sampled
+// clusters.
+func (c *Clustering) Subsample(n int) *Clustering {
+	c.subsampleSize = n
+	return c
+}
+
+// OutlierDetection enables per-cluster outlier detection: points whose
+// distance to their cluster's centroid is unusually large are moved from
+// Cluster.Points into Cluster.Outliers.
+func (c *Clustering) OutlierDetection() *Clustering {
+	c.outlierDetection = true
+	return c
+}
+
+// NearestNeighbor enables nearest-neighbor based assignment: Assign finds,
+// for each new point, the closest already-clustered point and labels the
+// new point with that point's cluster.
+func (c *Clustering) NearestNeighbor() *Clustering {
+	c.nearestNeighbor = true
+	return c
+}
+
+// OutlierClustering extends NearestNeighbor-based assignment so that
+// outliers are also considered when searching for a new point's nearest
+// neighbor, rather than only the inlier points of each cluster.
+func (c *Clustering) OutlierClustering() *Clustering {
+	c.outlierClustering = true
+	return c
+}
+
+// Voronoi enables centroid based assignment: Assign labels new points with
+// the cluster whose centroid is closest, i.e. partitions the space into
+// Voronoi regions.
+func (c *Clustering) Voronoi() *Clustering {
+	c.voronoi = true
+	return c
+}
+
+// VPTreeIndex enables a vantage-point tree as the nearest-neighbor backend
+// for coreDistance and mutual reachability graph construction, in place of
+// brute-force pairwise distances. This trades a small amount of
+// construction overhead for much better scaling on large or
+// high-dimensional data sets. It requires a metric distance function (see
+// DistanceFunc.IsMetric): Run returns an error otherwise.
+func (c *Clustering) VPTreeIndex() *Clustering {
+	c.vpTreeIndex = true
+	return c
+}
+
+// WithDistance sets the distance function used by lower-level methods
+// (mutualReachabilityGraph, buildDendrogram, and the like) called directly
+// rather than through Run, which takes its own distanceFunc argument and
+// overwrites this setting. Use it together with RegisterDistance when
+// supplying a custom DistanceFunc with the same metadata contract as the
+// built-in ones.
+func (c *Clustering) WithDistance(fn DistanceFunc) *Clustering {
+	c.distanceFunc = fn
+	return c
+}
+
+// HNSWIndex enables a Hierarchical Navigable Small World graph as the
+// nearest-neighbor backend for coreDistance, mutual reachability graph
+// construction, and NearestNeighbor-based Assign. It scales better than
+// VPTreeIndex on very large or very high-dimensional data sets, at the
+// cost of returning approximate rather than exact neighbors. m is the base
+// per-layer connectivity, efConstruction the insertion beam width, and
+// efSearch the query-time beam width; raising any of the three improves
+// recall at the cost of speed.
+func (c *Clustering) HNSWIndex(m, efConstruction, efSearch int) *Clustering {
+	c.hnswIndex = true
+	c.hnswM = m
+	c.hnswEfConstruction = efConstruction
+	c.hnswEfSearch = efSearch
+	return c
+}
+
+func (c *Clustering) log(format string, args ...interface{}) {
+	if c.verbose {
+		c.logger.Printf(format, args...)
+	}
+}
+
+// Run executes the full HDBSCAN pipeline: building the mutual
+// reachability graph, the single-linkage dendrogram, the flat clusters,
+// and scoring/selecting the most stable clustering. minTree determines
+// whether the mutual reachability graph is first reduced to a minimum
+// spanning tree (faster, recommended) or left as the complete pairwise
+// graph; with VPTreeIndex or HNSWIndex a spanning tree is always built and
+// minTree has no effect on the graph.
+func (c *Clustering) Run(distanceFunc DistanceFunc, scoreFunc ClusterScore, minTree bool) error {
+	if c.vpTreeIndex && !distanceFunc.IsMetric {
+		return fmt.Errorf("hdbscan: VPTreeIndex requires a metric distance function, %q is not marked IsMetric", distanceFunc.Name)
+	}
+	if distanceFunc.Validate != nil {
+		if err := distanceFunc.Validate(c.data); err != nil {
+			return fmt.Errorf("hdbscan: data is not valid for distance function %q: %w", distanceFunc.Name, err)
+		}
+	}
+
+	c.distanceFunc = distanceFunc
+	c.minTree = minTree
+
+	if c.subsampleSize > 0 && c.subsampleSize < len(c.data) {
+		c.data = subsample(c.data, c.subsampleSize)
+		c.log("subsampled data set to %d points", len(c.data))
+	}
+
+	if c.vpTreeIndex {
+		c.log("building vantage-point tree index over %d points", len(c.data))
+		c.vpTree = newVPTree(c.data, c.distanceFunc)
+	}
+
+	if c.hnswIndex {
+		c.log("building HNSW index over %d points", len(c.data))
+		c.hnswGraph = newHNSWGraph(c)
+	}
+
+	c.log("building mutual reachability graph")
+	graph := c.mutualReachabilityGraph()
+
+	c.log("building dendrogram from %d edges", len(graph))
+	dendrogram := c.buildDendrogram(graph)
+
+	c.log("extracting clusters from dendrogram")
+	c.buildClusters(dendrogram)
+
+	c.log("scoring %d clusters", len(c.Clusters))
+	c.scoreClusters(scoreFunc)
+	c.selectOptimalClustering(scoreFunc)
+
+	if c.outlierDetection {
+		c.detectOutliers()
+	}
+
+	if c.voronoi {
+		c.clusterCentroids()
+		c.outliersAndVoronoi()
+	}
+
+	c.log("done: %d clusters", len(c.Clusters))
+	return nil
+}
+
+// newHNSWGraph builds an HNSW index over c.data using c's configured M,
+// EfConstruction and distance function. It is shared by Run (building the
+// index fresh) and Load (rebuilding it over a restored data set).
+func newHNSWGraph(c *Clustering) *hnsw.Graph {
+	graph := hnsw.New(c.hnswM, c.hnswEfConstruction, c.distanceFunc.Func)
+	for i, point := range c.data {
+		graph.Insert(i, point)
+	}
+	return graph
+}
+
+// subsample deterministically selects n points spread evenly across data,
+// which keeps test runs and debugging reproducible.
+func subsample(data [][]float64, n int) [][]float64 {
+	if n >= len(data) {
+		return data
+	}
+
+	sampled := make([][]float64, 0, n)
+	step := float64(len(data)) / float64(n)
+	for i := 0; i < n; i++ {
+		sampled = append(sampled, data[int(float64(i)*step)])
+	}
+	return sampled
+}
@@ -1,338 +1,632 @@
-// Copyright 2020 Humility AI Incorporated, All Rights Reserved.
-//
-// Licensed under the Apache License, Version 2.0 (the "License");
-// you may not use this file except in compliance with the License.
-// You may obtain a copy of the License at
-//
-//     http://www.apache.org/licenses/LICENSE-2.0
-//
-// Unless required by applicable law or agreed to in writing, software
-// distributed under the License is distributed on an "AS IS" BASIS,
-// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
-// See the License for the specific language governing permissions and
-// limitations under the License.
-
-package hdbscan
-
-import (
-	"fmt"
-	"sort"
-	"testing"
-)
-
-var (
-	data = [][]float64{
-		// cluster-1 (0-7)
-		{1, 2, 3},
-		{1, 2, 4},
-		{1, 2, 5},
-		{1, 3, 4},
-		{2, 3, 3},
-		{2, 2, 4},
-		{2, 2, 5},
-		{2, 3, 4},
-		// cluster-2 (8-15)
-		{21, 15, 6},
-		{22, 15, 5},
-		{23, 15, 7},
-		{24, 15, 8},
-		{21, 15, 6},
-		{22, 16, 5},
-		{23, 17, 7},
-		{24, 18, 8},
-		// cluster-3 (16-23)
-		{80, 85, 90},
-		{89, 90, 91},
-		{100, 100, 100}, // possible outlier
-		{90, 90, 90},
-		{81, 85, 90},
-		{89, 91, 91},
-		{100, 101, 100}, // possible outlier
-		{90, 91, 90},
-		// outlier
-		{-2400, 2000, -30},
-	}
-	minimumClusterSize = 3
-)
-
-func TestMinimumSpanningTree(t *testing.T) {
-	clustering, err := NewClustering(data, minimumClusterSize)
-	if err != nil {
-		t.Errorf("clustering creation error: %+v", err)
-	}
-	clustering.distanceFunc = EuclideanDistance
-	clustering.minTree = true
-
-	// graph
-	fmt.Println(clustering.mutualReachabilityGraph())
-}
-
-func TestBuildDendrogram(t *testing.T) {
-	clustering, err := NewClustering(data, minimumClusterSize)
-	if err != nil {
-		t.Errorf("clustering creation error: %+v", err)
-	}
-	clustering.distanceFunc = EuclideanDistance
-	clustering.minTree = true
-
-	// cluster-hierarchy
-	dendrogram := clustering.buildDendrogram(clustering.mutualReachabilityGraph())
-
-	for _, link := range dendrogram {
-		t.Logf("Link %+v with points: %+v", link.id, link.points)
-	}
-}
-
-func TestBuildClusters(t *testing.T) {
-	clustering, err := NewClustering(data, minimumClusterSize)
-	if err != nil {
-		t.Errorf("clustering creation error: %+v", err)
-	}
-	clustering.distanceFunc = EuclideanDistance
-	// clustering.minTree = true
-
-	// cluster-hierarchy
-	dendrogram := clustering.buildDendrogram(clustering.mutualReachabilityGraph())
-	clustering.buildClusters(dendrogram)
-
-	for _, cluster := range clustering.Clusters {
-		sort.Ints(cluster.Points)
-		t.Logf("Cluster %+v with points: %+v", cluster.id, cluster.Points)
-	}
-}
-
-func TestClusterScoring(t *testing.T) {
-	clustering, err := NewClustering(data, minimumClusterSize)
-	if err != nil {
-		t.Errorf("clustering creation error: %+v", err)
-	}
-	clustering.distanceFunc = EuclideanDistance
-
-	// cluster-hierarchy
-	dendrogram := clustering.buildDendrogram(clustering.mutualReachabilityGraph())
-	clustering.buildClusters(dendrogram)
-	clustering.scoreClusters(VarianceScore)
-
-	for _, cluster := range clustering.Clusters {
-		sort.Ints(cluster.Points)
-		t.Logf("Cluster %+v with variance %+v and score %+v and points: %+v", cluster.id, cluster.variance, cluster.score, cluster.Points)
-	}
-}
-
-func TestClustering(t *testing.T) {
-	clustering, err := NewClustering(data, minimumClusterSize)
-	if err != nil {
-		t.Errorf("clustering creation error: %+v", err)
-	}
-
-	err = clustering.Run(EuclideanDistance, VarianceScore, true)
-	if err != nil {
-		t.Errorf("clustering run error: %+v", err)
-	}
-
-	for _, cluster := range clustering.Clusters {
-		sort.Ints(cluster.Points)
-		t.Logf("Cluster %+v with points: %+v", cluster.id, cluster.Points)
-	}
-}
-
-func TestClusteringNoTree(t *testing.T) {
-	clustering, err := NewClustering(data, minimumClusterSize)
-	if err != nil {
-		t.Errorf("clustering creation error: %+v", err)
-	}
-
-	err = clustering.Run(EuclideanDistance, VarianceScore, false)
-	if err != nil {
-		t.Errorf("clustering run error: %+v", err)
-	}
-
-	for _, cluster := range clustering.Clusters {
-		sort.Ints(cluster.Points)
-		t.Logf("Cluster %+v with points: %+v", cluster.id, cluster.Points)
-	}
-}
-
-func TestClusteringVerbose(t *testing.T) {
-	c, err := NewClustering(data, minimumClusterSize)
-	if err != nil {
-		t.Errorf("clustering creation error: %+v", err)
-	}
-	c = c.Verbose()
-
-	err = c.Run(EuclideanDistance, VarianceScore, false)
-	if err != nil {
-		t.Errorf("clustering run error: %+v", err)
-	}
-
-	for _, cluster := range c.Clusters {
-		sort.Ints(cluster.Points)
-		t.Logf("Cluster %+v with points: %+v", cluster.id, cluster.Points)
-	}
-}
-
-func TestClusteringSampling(t *testing.T) {
-	c, err := NewClustering(data, minimumClusterSize)
-	if err != nil {
-		t.Errorf("clustering creation error: %+v", err)
-	}
-	c = c.Verbose().Subsample(16)
-
-	err = c.Run(EuclideanDistance, VarianceScore, true)
-	if err != nil {
-		t.Errorf("clustering run error: %+v", err)
-	}
-
-	for _, cluster := range c.Clusters {
-		sort.Ints(cluster.Points)
-		t.Logf("Cluster %+v with points: %+v", cluster.id, cluster.Points)
-	}
-}
-
-func TestClusteringSamplingAndAssign(t *testing.T) {
-	c, err := NewClustering(data, minimumClusterSize)
-	if err != nil {
-		t.Errorf("clustering creation error: %+v", err)
-	}
-	c = c.Subsample(16).OutlierDetection()
-
-	err = c.Run(EuclideanDistance, VarianceScore, true)
-	if err != nil {
-		t.Errorf("clustering run error: %+v", err)
-	}
-
-	newClustering, err := c.Assign(data)
-	if err != nil {
-		t.Errorf("clustering run error: %+v", err)
-	}
-
-	for _, cluster := range newClustering.Clusters {
-		sort.Ints(cluster.Points)
-		t.Logf("Cluster %+v with points: %+v", cluster.id, cluster.Points)
-	}
-}
-
-func TestClusteringSamplingAndAssignAndOutlierClustering(t *testing.T) {
-	c, err := NewClustering(data, minimumClusterSize)
-	if err != nil {
-		t.Errorf("clustering creation error: %+v", err)
-	}
-	c = c.Subsample(16).NearestNeighbor().OutlierClustering()
-
-	err = c.Run(EuclideanDistance, VarianceScore, true)
-	if err != nil {
-		t.Errorf("clustering run error: %+v", err)
-	}
-
-	newClustering, err := c.Assign(data)
-	if err != nil {
-		t.Errorf("clustering run error: %+v", err)
-	}
-
-	for _, cluster := range newClustering.Clusters {
-		sort.Ints(cluster.Points)
-		t.Logf("Cluster %+v with points: %+v", cluster.id, cluster.Points)
-	}
-}
-
-func TestClusteringOutliers(t *testing.T) {
-	c, err := NewClustering(data, minimumClusterSize)
-	if err != nil {
-		t.Errorf("clustering creation error: %+v", err)
-	}
-
-	c = c.OutlierDetection().NearestNeighbor()
-
-	err = c.Run(EuclideanDistance, VarianceScore, true)
-	if err != nil {
-		t.Errorf("clustering run error: %+v", err)
-	}
-
-	for _, cluster := range c.Clusters {
-		sort.Ints(cluster.Points)
-		t.Logf("Cluster %+v with Points %+v and outliers: %+v", cluster.id, cluster.Points, cluster.Outliers)
-	}
-}
-
-func TestClusteringVoronoi(t *testing.T) {
-	c, err := NewClustering(data, minimumClusterSize)
-	if err != nil {
-		t.Errorf("clustering creation error: %+v", err)
-	}
-	c = c.Verbose().Voronoi()
-
-	err = c.Run(EuclideanDistance, VarianceScore, true)
-	if err != nil {
-		t.Errorf("clustering run error: %+v", err)
-	}
-
-	for _, cluster := range c.Clusters {
-		sort.Ints(cluster.Points)
-		t.Logf("Cluster %+v with points: %+v", cluster.id, cluster.Points)
-	}
-}
-
-func TestClusteringVoronoiParts(t *testing.T) {
-	c, err := NewClustering(data, minimumClusterSize)
-	if err != nil {
-		t.Errorf("clustering creation error: %+v", err)
-	}
-	c = c.Verbose().Voronoi()
-	c.distanceFunc = EuclideanDistance
-	c.minTree = true
-
-	edges := c.mutualReachabilityGraph()
-	t.Logf("%+v\n", edges)
-	dendrogram := c.buildDendrogram(edges)
-	for _, link := range dendrogram {
-		t.Logf("Link %+v with points: %+v", link.id, link.points)
-	}
-
-	c.buildClusters(dendrogram)
-	for _, cluster := range c.Clusters {
-		sort.Ints(cluster.Points)
-		t.Logf("Cluster %+v with points: %+v", cluster.id, cluster.Points)
-	}
-
-	c.scoreClusters(VarianceScore)
-	for _, cluster := range c.Clusters {
-		sort.Ints(cluster.Points)
-		t.Logf("Cluster %+v with variance %+v and score %+v and points: %+v", cluster.id, cluster.variance, cluster.score, cluster.Points)
-	}
-
-	c.selectOptimalClustering(VarianceScore)
-	for _, cluster := range c.Clusters {
-		sort.Ints(cluster.Points)
-		t.Logf("Cluster %+v with variance %+v and score %+v and points: %+v", cluster.id, cluster.variance, cluster.score, cluster.Points)
-	}
-
-	c.clusterCentroids()
-	for _, cluster := range c.Clusters {
-		sort.Ints(cluster.Points)
-		t.Logf("Cluster %+v with variance %+v and score %+v and points: %+v and Centroid %+v", cluster.id, cluster.variance, cluster.score, cluster.Points, cluster.Centroid)
-	}
-
-	c.outliersAndVoronoi()
-	for _, cluster := range c.Clusters {
-		sort.Ints(cluster.Points)
-		t.Logf("Cluster %+v with variance %+v and score %+v and points: %+v and Centroid %+v", cluster.id, cluster.variance, cluster.score, cluster.Points, cluster.Centroid)
-	}
-}
-
-func TestClusteringVoronoiNoTree(t *testing.T) {
-	c, err := NewClustering(data, minimumClusterSize)
-	if err != nil {
-		t.Errorf("clustering creation error: %+v", err)
-	}
-	c = c.Verbose().Voronoi()
-
-	err = c.Run(EuclideanDistance, VarianceScore, false)
-	if err != nil {
-		t.Errorf("clustering run error: %+v", err)
-	}
-
-	for _, cluster := range c.Clusters {
-		sort.Ints(cluster.Points)
-		t.Logf("Cluster %+v with points: %+v", cluster.id, cluster.Points)
-	}
-}
+// Copyright 2020 Humility AI Incorporated, All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hdbscan
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+var (
+	data = [][]float64{
+		// cluster-1 (0-7)
+		{1, 2, 3},
+		{1, 2, 4},
+		{1, 2, 5},
+		{1, 3, 4},
+		{2, 3, 3},
+		{2, 2, 4},
+		{2, 2, 5},
+		{2, 3, 4},
+		// cluster-2 (8-15)
+		{21, 15, 6},
+		{22, 15, 5},
+		{23, 15, 7},
+		{24, 15, 8},
+		{21, 15, 6},
+		{22, 16, 5},
+		{23, 17, 7},
+		{24, 18, 8},
+		// cluster-3 (16-23)
+		{80, 85, 90},
+		{89, 90, 91},
+		{100, 100, 100}, // possible outlier
+		{90, 90, 90},
+		{81, 85, 90},
+		{89, 91, 91},
+		{100, 101, 100}, // possible outlier
+		{90, 91, 90},
+		// outlier
+		{-2400, 2000, -30},
+	}
+	minimumClusterSize = 3
+)
+
+func TestMinimumSpanningTree(t *testing.T) {
+	clustering, err := NewClustering(data, minimumClusterSize)
+	if err != nil {
+		t.Errorf("clustering creation error: %+v", err)
+	}
+	clustering = clustering.WithDistance(EuclideanDistance)
+	clustering.minTree = true
+
+	// graph
+	fmt.Println(clustering.mutualReachabilityGraph())
+}
+
+func TestBuildDendrogram(t *testing.T) {
+	clustering, err := NewClustering(data, minimumClusterSize)
+	if err != nil {
+		t.Errorf("clustering creation error: %+v", err)
+	}
+	clustering = clustering.WithDistance(EuclideanDistance)
+	clustering.minTree = true
+
+	// cluster-hierarchy
+	dendrogram := clustering.buildDendrogram(clustering.mutualReachabilityGraph())
+
+	for _, link := range dendrogram {
+		t.Logf("Link %+v with points: %+v", link.id, link.points)
+	}
+}
+
+func TestBuildClusters(t *testing.T) {
+	clustering, err := NewClustering(data, minimumClusterSize)
+	if err != nil {
+		t.Errorf("clustering creation error: %+v", err)
+	}
+	clustering = clustering.WithDistance(EuclideanDistance)
+	// clustering.minTree = true
+
+	// cluster-hierarchy
+	dendrogram := clustering.buildDendrogram(clustering.mutualReachabilityGraph())
+	clustering.buildClusters(dendrogram)
+
+	for _, cluster := range clustering.Clusters {
+		sort.Ints(cluster.Points)
+		t.Logf("Cluster %+v with points: %+v", cluster.id, cluster.Points)
+	}
+}
+
+func TestClusterScoring(t *testing.T) {
+	clustering, err := NewClustering(data, minimumClusterSize)
+	if err != nil {
+		t.Errorf("clustering creation error: %+v", err)
+	}
+	clustering = clustering.WithDistance(EuclideanDistance)
+
+	// cluster-hierarchy
+	dendrogram := clustering.buildDendrogram(clustering.mutualReachabilityGraph())
+	clustering.buildClusters(dendrogram)
+	clustering.scoreClusters(VarianceScore)
+
+	for _, cluster := range clustering.Clusters {
+		sort.Ints(cluster.Points)
+		t.Logf("Cluster %+v with variance %+v and score %+v and points: %+v", cluster.id, cluster.variance, cluster.score, cluster.Points)
+	}
+}
+
+func TestClustering(t *testing.T) {
+	clustering, err := NewClustering(data, minimumClusterSize)
+	if err != nil {
+		t.Errorf("clustering creation error: %+v", err)
+	}
+
+	err = clustering.Run(EuclideanDistance, VarianceScore, true)
+	if err != nil {
+		t.Errorf("clustering run error: %+v", err)
+	}
+
+	for _, cluster := range clustering.Clusters {
+		sort.Ints(cluster.Points)
+		t.Logf("Cluster %+v with points: %+v", cluster.id, cluster.Points)
+	}
+}
+
+func TestClusteringNoTree(t *testing.T) {
+	clustering, err := NewClustering(data, minimumClusterSize)
+	if err != nil {
+		t.Errorf("clustering creation error: %+v", err)
+	}
+
+	err = clustering.Run(EuclideanDistance, VarianceScore, false)
+	if err != nil {
+		t.Errorf("clustering run error: %+v", err)
+	}
+
+	for _, cluster := range clustering.Clusters {
+		sort.Ints(cluster.Points)
+		t.Logf("Cluster %+v with points: %+v", cluster.id, cluster.Points)
+	}
+}
+
+func TestClusteringVerbose(t *testing.T) {
+	c, err := NewClustering(data, minimumClusterSize)
+	if err != nil {
+		t.Errorf("clustering creation error: %+v", err)
+	}
+	c = c.Verbose()
+
+	err = c.Run(EuclideanDistance, VarianceScore, false)
+	if err != nil {
+		t.Errorf("clustering run error: %+v", err)
+	}
+
+	for _, cluster := range c.Clusters {
+		sort.Ints(cluster.Points)
+		t.Logf("Cluster %+v with points: %+v", cluster.id, cluster.Points)
+	}
+}
+
+func TestClusteringSampling(t *testing.T) {
+	c, err := NewClustering(data, minimumClusterSize)
+	if err != nil {
+		t.Errorf("clustering creation error: %+v", err)
+	}
+	c = c.Verbose().Subsample(16)
+
+	err = c.Run(EuclideanDistance, VarianceScore, true)
+	if err != nil {
+		t.Errorf("clustering run error: %+v", err)
+	}
+
+	for _, cluster := range c.Clusters {
+		sort.Ints(cluster.Points)
+		t.Logf("Cluster %+v with points: %+v", cluster.id, cluster.Points)
+	}
+}
+
+func TestClusteringSamplingAndAssign(t *testing.T) {
+	c, err := NewClustering(data, minimumClusterSize)
+	if err != nil {
+		t.Errorf("clustering creation error: %+v", err)
+	}
+	c = c.Subsample(16).OutlierDetection()
+
+	err = c.Run(EuclideanDistance, VarianceScore, true)
+	if err != nil {
+		t.Errorf("clustering run error: %+v", err)
+	}
+
+	newClustering, err := c.Assign(data)
+	if err != nil {
+		t.Errorf("clustering run error: %+v", err)
+	}
+
+	for _, cluster := range newClustering.Clusters {
+		sort.Ints(cluster.Points)
+		t.Logf("Cluster %+v with points: %+v", cluster.id, cluster.Points)
+	}
+}
+
+func TestClusteringSamplingAndAssignAndOutlierClustering(t *testing.T) {
+	c, err := NewClustering(data, minimumClusterSize)
+	if err != nil {
+		t.Errorf("clustering creation error: %+v", err)
+	}
+	c = c.Subsample(16).NearestNeighbor().OutlierClustering()
+
+	err = c.Run(EuclideanDistance, VarianceScore, true)
+	if err != nil {
+		t.Errorf("clustering run error: %+v", err)
+	}
+
+	newClustering, err := c.Assign(data)
+	if err != nil {
+		t.Errorf("clustering run error: %+v", err)
+	}
+
+	for _, cluster := range newClustering.Clusters {
+		sort.Ints(cluster.Points)
+		t.Logf("Cluster %+v with points: %+v", cluster.id, cluster.Points)
+	}
+}
+
+func TestClusteringOutliers(t *testing.T) {
+	c, err := NewClustering(data, minimumClusterSize)
+	if err != nil {
+		t.Errorf("clustering creation error: %+v", err)
+	}
+
+	c = c.OutlierDetection().NearestNeighbor()
+
+	err = c.Run(EuclideanDistance, VarianceScore, true)
+	if err != nil {
+		t.Errorf("clustering run error: %+v", err)
+	}
+
+	for _, cluster := range c.Clusters {
+		sort.Ints(cluster.Points)
+		t.Logf("Cluster %+v with Points %+v and outliers: %+v", cluster.id, cluster.Points, cluster.Outliers)
+	}
+}
+
+func TestClusteringVoronoi(t *testing.T) {
+	c, err := NewClustering(data, minimumClusterSize)
+	if err != nil {
+		t.Errorf("clustering creation error: %+v", err)
+	}
+	c = c.Verbose().Voronoi()
+
+	err = c.Run(EuclideanDistance, VarianceScore, true)
+	if err != nil {
+		t.Errorf("clustering run error: %+v", err)
+	}
+
+	for _, cluster := range c.Clusters {
+		sort.Ints(cluster.Points)
+		t.Logf("Cluster %+v with points: %+v", cluster.id, cluster.Points)
+	}
+}
+
+func TestClusteringVoronoiParts(t *testing.T) {
+	c, err := NewClustering(data, minimumClusterSize)
+	if err != nil {
+		t.Errorf("clustering creation error: %+v", err)
+	}
+	c = c.Verbose().Voronoi()
+	c = c.WithDistance(EuclideanDistance)
+	c.minTree = true
+
+	edges := c.mutualReachabilityGraph()
+	t.Logf("%+v\n", edges)
+	dendrogram := c.buildDendrogram(edges)
+	for _, link := range dendrogram {
+		t.Logf("Link %+v with points: %+v", link.id, link.points)
+	}
+
+	c.buildClusters(dendrogram)
+	for _, cluster := range c.Clusters {
+		sort.Ints(cluster.Points)
+		t.Logf("Cluster %+v with points: %+v", cluster.id, cluster.Points)
+	}
+
+	c.scoreClusters(VarianceScore)
+	for _, cluster := range c.Clusters {
+		sort.Ints(cluster.Points)
+		t.Logf("Cluster %+v with variance %+v and score %+v and points: %+v", cluster.id, cluster.variance, cluster.score, cluster.Points)
+	}
+
+	c.selectOptimalClustering(VarianceScore)
+	for _, cluster := range c.Clusters {
+		sort.Ints(cluster.Points)
+		t.Logf("Cluster %+v with variance %+v and score %+v and points: %+v", cluster.id, cluster.variance, cluster.score, cluster.Points)
+	}
+
+	c.clusterCentroids()
+	for _, cluster := range c.Clusters {
+		sort.Ints(cluster.Points)
+		t.Logf("Cluster %+v with variance %+v and score %+v and points: %+v and Centroid %+v", cluster.id, cluster.variance, cluster.score, cluster.Points, cluster.Centroid)
+	}
+
+	c.outliersAndVoronoi()
+	for _, cluster := range c.Clusters {
+		sort.Ints(cluster.Points)
+		t.Logf("Cluster %+v with variance %+v and score %+v and points: %+v and Centroid %+v", cluster.id, cluster.variance, cluster.score, cluster.Points, cluster.Centroid)
+	}
+}
+
+func TestClusteringVoronoiNoTree(t *testing.T) {
+	c, err := NewClustering(data, minimumClusterSize)
+	if err != nil {
+		t.Errorf("clustering creation error: %+v", err)
+	}
+	c = c.Verbose().Voronoi()
+
+	err = c.Run(EuclideanDistance, VarianceScore, false)
+	if err != nil {
+		t.Errorf("clustering run error: %+v", err)
+	}
+
+	for _, cluster := range c.Clusters {
+		sort.Ints(cluster.Points)
+		t.Logf("Cluster %+v with points: %+v", cluster.id, cluster.Points)
+	}
+}
+
+func TestClusteringVPTreeIndex(t *testing.T) {
+	c, err := NewClustering(data, minimumClusterSize)
+	if err != nil {
+		t.Errorf("clustering creation error: %+v", err)
+	}
+	c = c.VPTreeIndex()
+
+	err = c.Run(EuclideanDistance, VarianceScore, true)
+	if err != nil {
+		t.Errorf("clustering run error: %+v", err)
+	}
+
+	for _, cluster := range c.Clusters {
+		sort.Ints(cluster.Points)
+		t.Logf("Cluster %+v with points: %+v", cluster.id, cluster.Points)
+	}
+}
+
+func TestClusteringVPTreeIndexRequiresMetric(t *testing.T) {
+	nonMetric := DistanceFunc{Name: "non-metric", Func: EuclideanDistance.Func, IsMetric: false}
+
+	c, err := NewClustering(data, minimumClusterSize)
+	if err != nil {
+		t.Errorf("clustering creation error: %+v", err)
+	}
+	c = c.VPTreeIndex()
+
+	if err := c.Run(nonMetric, VarianceScore, true); err == nil {
+		t.Errorf("expected an error when pairing VPTreeIndex with a non-metric distance function")
+	}
+}
+
+func TestClusteringHNSWIndex(t *testing.T) {
+	c, err := NewClustering(data, minimumClusterSize)
+	if err != nil {
+		t.Errorf("clustering creation error: %+v", err)
+	}
+	c = c.HNSWIndex(8, 32, 16)
+
+	err = c.Run(EuclideanDistance, VarianceScore, true)
+	if err != nil {
+		t.Errorf("clustering run error: %+v", err)
+	}
+
+	for _, cluster := range c.Clusters {
+		sort.Ints(cluster.Points)
+		t.Logf("Cluster %+v with points: %+v", cluster.id, cluster.Points)
+	}
+}
+
+func TestClusteringHNSWIndexAssign(t *testing.T) {
+	c, err := NewClustering(data, minimumClusterSize)
+	if err != nil {
+		t.Errorf("clustering creation error: %+v", err)
+	}
+	c = c.HNSWIndex(8, 32, 16).NearestNeighbor()
+
+	err = c.Run(EuclideanDistance, VarianceScore, true)
+	if err != nil {
+		t.Errorf("clustering run error: %+v", err)
+	}
+
+	newClustering, err := c.Assign(data)
+	if err != nil {
+		t.Errorf("clustering assign error: %+v", err)
+	}
+
+	for _, cluster := range newClustering.Clusters {
+		sort.Ints(cluster.Points)
+		t.Logf("Cluster %+v with points: %+v", cluster.id, cluster.Points)
+	}
+}
+
+func TestSaveLoadRoundTrip(t *testing.T) {
+	builders := map[string]func(*Clustering) *Clustering{
+		"default":           func(c *Clustering) *Clustering { return c },
+		"Voronoi":           func(c *Clustering) *Clustering { return c.Voronoi() },
+		"OutlierDetection":  func(c *Clustering) *Clustering { return c.OutlierDetection() },
+		"Subsample":         func(c *Clustering) *Clustering { return c.Subsample(16) },
+		"NearestNeighbor":   func(c *Clustering) *Clustering { return c.NearestNeighbor() },
+		"OutlierClustering": func(c *Clustering) *Clustering { return c.NearestNeighbor().OutlierClustering() },
+		"VPTreeIndex":       func(c *Clustering) *Clustering { return c.VPTreeIndex() },
+		"HNSWIndex":         func(c *Clustering) *Clustering { return c.HNSWIndex(8, 32, 16) },
+	}
+
+	for name, build := range builders {
+		t.Run(name, func(t *testing.T) {
+			c, err := NewClustering(data, minimumClusterSize)
+			if err != nil {
+				t.Fatalf("clustering creation error: %+v", err)
+			}
+			c = build(c)
+
+			if err := c.Run(EuclideanDistance, VarianceScore, true); err != nil {
+				t.Fatalf("clustering run error: %+v", err)
+			}
+
+			var buf bytes.Buffer
+			if err := c.Save(&buf); err != nil {
+				t.Fatalf("save error: %+v", err)
+			}
+
+			loaded, err := Load(&buf)
+			if err != nil {
+				t.Fatalf("load error: %+v", err)
+			}
+
+			if len(loaded.Clusters) != len(c.Clusters) {
+				t.Fatalf("loaded %d clusters, want %d", len(loaded.Clusters), len(c.Clusters))
+			}
+
+			for i, want := range c.Clusters {
+				got := loaded.Clusters[i]
+				if got.id != want.id {
+					t.Errorf("cluster %d: id = %d, want %d", i, got.id, want.id)
+				}
+				if !reflect.DeepEqual(got.Centroid, want.Centroid) {
+					t.Errorf("cluster %d: centroid = %v, want %v", i, got.Centroid, want.Centroid)
+				}
+				if len(got.Points) != len(want.Points) {
+					t.Errorf("cluster %d: %d points, want %d", i, len(got.Points), len(want.Points))
+				}
+				if len(got.Outliers) != len(want.Outliers) {
+					t.Errorf("cluster %d: %d outliers, want %d", i, len(got.Outliers), len(want.Outliers))
+				}
+				if got.score != want.score {
+					t.Errorf("cluster %d: score = %v, want %v", i, got.score, want.score)
+				}
+				if got.variance != want.variance {
+					t.Errorf("cluster %d: variance = %v, want %v", i, got.variance, want.variance)
+				}
+			}
+
+			newClustering, err := loaded.Assign(data)
+			if err != nil {
+				t.Fatalf("assign on loaded clustering error: %+v", err)
+			}
+
+			var assigned int
+			for _, cluster := range newClustering.Clusters {
+				assigned += len(cluster.Points)
+			}
+			if assigned == 0 {
+				t.Errorf("loaded clustering assigned no points")
+			}
+		})
+	}
+}
+
+func TestManhattanDistance(t *testing.T) {
+	got := ManhattanDistance.Func([]float64{0, 0}, []float64{3, 4})
+	if got != 7 {
+		t.Errorf("ManhattanDistance = %v, want 7", got)
+	}
+}
+
+func TestCosineDistance(t *testing.T) {
+	orthogonal := CosineDistance.Func([]float64{1, 0}, []float64{0, 1})
+	if math.Abs(orthogonal-1) > 1e-9 {
+		t.Errorf("CosineDistance of orthogonal vectors = %v, want 1", orthogonal)
+	}
+
+	identical := CosineDistance.Func([]float64{2, 2}, []float64{1, 1})
+	if math.Abs(identical) > 1e-9 {
+		t.Errorf("CosineDistance of parallel vectors = %v, want 0", identical)
+	}
+
+	zero := CosineDistance.Func([]float64{0, 0}, []float64{1, 1})
+	if zero != 2 {
+		t.Errorf("CosineDistance involving the zero vector = %v, want 2", zero)
+	}
+}
+
+func TestHaversineDistance(t *testing.T) {
+	// London to Paris, roughly 344 km apart.
+	london := []float64{51.5074, -0.1278}
+	paris := []float64{48.8566, 2.3522}
+
+	got := HaversineDistance.Func(london, paris)
+	if got < 300 || got > 400 {
+		t.Errorf("HaversineDistance(london, paris) = %v km, want ~344 km", got)
+	}
+}
+
+func TestHaversineDistanceValidate(t *testing.T) {
+	if err := HaversineDistance.Validate([][]float64{{51.5074, -0.1278}}); err != nil {
+		t.Errorf("unexpected validation error for a valid lat/lon point: %+v", err)
+	}
+	if err := HaversineDistance.Validate([][]float64{{1, 2, 3}}); err == nil {
+		t.Error("expected a validation error for a 3-D point")
+	}
+	if err := HaversineDistance.Validate([][]float64{{91, 0}}); err == nil {
+		t.Error("expected a validation error for an out-of-range latitude")
+	}
+}
+
+func TestJaccardDistance(t *testing.T) {
+	got := JaccardDistance.Func([]float64{1, 1, 0, 0}, []float64{1, 0, 0, 1})
+	want := 1 - 1.0/3.0
+	if math.Abs(got-want) > 1e-9 {
+		t.Errorf("JaccardDistance = %v, want %v", got, want)
+	}
+
+	emptySets := JaccardDistance.Func([]float64{0, 0}, []float64{0, 0})
+	if emptySets != 0 {
+		t.Errorf("JaccardDistance of two empty sets = %v, want 0", emptySets)
+	}
+}
+
+func TestJaccardDistanceValidate(t *testing.T) {
+	if err := JaccardDistance.Validate([][]float64{{1, 0, 1}}); err != nil {
+		t.Errorf("unexpected validation error for a 0/1 point: %+v", err)
+	}
+	if err := JaccardDistance.Validate([][]float64{{0.5, 1}}); err == nil {
+		t.Error("expected a validation error for a non-binary value")
+	}
+}
+
+func TestClusteringWithDistanceNonEuclidean(t *testing.T) {
+	c, err := NewClustering(data, minimumClusterSize)
+	if err != nil {
+		t.Errorf("clustering creation error: %+v", err)
+	}
+
+	if err := c.Run(ManhattanDistance, VarianceScore, true); err != nil {
+		t.Errorf("clustering run error: %+v", err)
+	}
+
+	for _, cluster := range c.Clusters {
+		sort.Ints(cluster.Points)
+		t.Logf("Cluster %+v with points: %+v", cluster.id, cluster.Points)
+	}
+}
+
+func TestClusteringVPTreeIndexRejectsCosine(t *testing.T) {
+	c, err := NewClustering(data, minimumClusterSize)
+	if err != nil {
+		t.Errorf("clustering creation error: %+v", err)
+	}
+	c = c.VPTreeIndex()
+
+	if err := c.Run(CosineDistance, VarianceScore, true); err == nil {
+		t.Error("expected an error when pairing VPTreeIndex with cosine distance, which is not a metric")
+	}
+}
+
+func TestClusteringRejectsInvalidDomain(t *testing.T) {
+	c, err := NewClustering(data, minimumClusterSize)
+	if err != nil {
+		t.Errorf("clustering creation error: %+v", err)
+	}
+
+	if err := c.Run(HaversineDistance, VarianceScore, true); err == nil {
+		t.Error("expected an error running haversine distance over 3-D data")
+	}
+}
+
+func TestRegisterDistance(t *testing.T) {
+	custom := DistanceFunc{
+		Name:     "custom-chebyshev",
+		IsMetric: true,
+		Func: func(a, b []float64) float64 {
+			var max float64
+			for i := range a {
+				if d := math.Abs(a[i] - b[i]); d > max {
+					max = d
+				}
+			}
+			return max
+		},
+	}
+	RegisterDistance(custom)
+
+	c, err := NewClustering(data, minimumClusterSize)
+	if err != nil {
+		t.Errorf("clustering creation error: %+v", err)
+	}
+
+	if err := c.Run(custom, VarianceScore, true); err != nil {
+		t.Errorf("clustering run error: %+v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := c.Save(&buf); err != nil {
+		t.Fatalf("save error: %+v", err)
+	}
+	if _, err := Load(&buf); err != nil {
+		t.Errorf("load error after registering a custom distance function: %+v", err)
+	}
+}
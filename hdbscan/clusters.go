@@ -0,0 +1,158 @@
+// Copyright 2020 Humility AI Incorporated, All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hdbscan
+
+import (
+	"math"
+	"sort"
+)
+
+// buildClusters walks the dendrogram down from its root and extracts the
+// smallest links whose point count has reached minimumClusterSize: the
+// first generation of candidate clusters. selectOptimalClustering later
+// decides whether any of these are better merged with one another.
+func (c *Clustering) buildClusters(dendrogram []*link) {
+	c.Clusters = nil
+
+	var extract func(l *link) []*link
+	extract = func(l *link) []*link {
+		if len(l.points) < c.minimumClusterSize {
+			return nil
+		}
+
+		var childClusters []*link
+		for _, child := range l.children {
+			childClusters = append(childClusters, extract(child)...)
+		}
+		if len(childClusters) > 0 {
+			return childClusters
+		}
+		return []*link{l}
+	}
+
+	var roots []*link
+	if len(dendrogram) > 0 {
+		roots = extract(dendrogram[len(dendrogram)-1])
+	}
+
+	id := 1
+	for _, l := range roots {
+		c.Clusters = append(c.Clusters, &Cluster{id: id, Points: append([]int(nil), l.points...)})
+		id++
+	}
+}
+
+// scoreClusters computes a score and variance for every current cluster
+// using scoreFunc.
+func (c *Clustering) scoreClusters(scoreFunc ClusterScore) {
+	for _, cluster := range c.Clusters {
+		cluster.score, cluster.variance = scoreFunc(cluster.Points, c.data, c.distanceFunc)
+	}
+}
+
+// selectOptimalClustering repeatedly merges any pair of the current flat
+// clusters whose combined score is at least the sum of their individual
+// scores, until no such pair is left, then renumbers the clusters from 1.
+// It does not consult the dendrogram and never splits a cluster.
+func (c *Clustering) selectOptimalClustering(scoreFunc ClusterScore) {
+	if len(c.Clusters) == 0 {
+		return
+	}
+
+	// Re-derive the full dendrogram shape isn't available here, so operate
+	// directly on the current flat clusters: merge any pair whose combined
+	// score exceeds the sum of their individual scores.
+	changed := true
+	for changed {
+		changed = false
+		for i := 0; i < len(c.Clusters); i++ {
+			for j := i + 1; j < len(c.Clusters); j++ {
+				merged := append(append([]int(nil), c.Clusters[i].Points...), c.Clusters[j].Points...)
+				mergedScore, mergedVariance := scoreFunc(merged, c.data, c.distanceFunc)
+				if mergedScore >= c.Clusters[i].score+c.Clusters[j].score {
+					c.Clusters[i].Points = merged
+					c.Clusters[i].score = mergedScore
+					c.Clusters[i].variance = mergedVariance
+					c.Clusters = append(c.Clusters[:j], c.Clusters[j+1:]...)
+					changed = true
+					break
+				}
+			}
+			if changed {
+				break
+			}
+		}
+	}
+
+	for i, cluster := range c.Clusters {
+		cluster.id = i + 1
+		sort.Ints(cluster.Points)
+	}
+}
+
+// detectOutliers moves points whose distance to their cluster's centroid
+// is more than two standard deviations above the mean distance into
+// Cluster.Outliers.
+func (c *Clustering) detectOutliers() {
+	for _, cluster := range c.Clusters {
+		if len(cluster.Points) == 0 {
+			continue
+		}
+
+		centroid := centroidOf(cluster.Points, c.data)
+		distances := make([]float64, len(cluster.Points))
+		var mean float64
+		for i, p := range cluster.Points {
+			distances[i] = c.distanceFunc.Func(c.data[p], centroid)
+			mean += distances[i]
+		}
+		mean /= float64(len(distances))
+
+		var variance float64
+		for _, d := range distances {
+			variance += (d - mean) * (d - mean)
+		}
+		variance /= float64(len(distances))
+		stddev := math.Sqrt(variance)
+		threshold := mean + 2*stddev
+
+		var inliers, outliers []int
+		for i, p := range cluster.Points {
+			if distances[i] > threshold {
+				outliers = append(outliers, p)
+			} else {
+				inliers = append(inliers, p)
+			}
+		}
+		cluster.Points = inliers
+		cluster.Outliers = outliers
+	}
+}
+
+func centroidOf(points []int, data [][]float64) []float64 {
+	if len(points) == 0 {
+		return nil
+	}
+	centroid := make([]float64, len(data[points[0]]))
+	for _, p := range points {
+		for i, v := range data[p] {
+			centroid[i] += v
+		}
+	}
+	for i := range centroid {
+		centroid[i] /= float64(len(points))
+	}
+	return centroid
+}
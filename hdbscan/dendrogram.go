@@ -0,0 +1,73 @@
+// Copyright 2020 Humility AI Incorporated, All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hdbscan
+
+// link is a single merge event in the single-linkage hierarchy: the set of
+// points joined together at the given mutual reachability distance.
+type link struct {
+	id       int
+	distance float64
+	points   []int
+	children []*link
+}
+
+// buildDendrogram performs single-linkage clustering over the mutual
+// reachability graph, recording every merge event as a link. Edges must be
+// sorted in ascending order of distance, as returned by
+// mutualReachabilityGraph.
+func (c *Clustering) buildDendrogram(edges []edge) []*link {
+	n := len(c.data)
+	uf := newUnionFind(n)
+	componentLink := make(map[int]*link, n)
+
+	var dendrogram []*link
+	for _, e := range edges {
+		ra, rb := uf.find(e.a), uf.find(e.b)
+		if ra == rb {
+			continue
+		}
+
+		linkA := componentLink[ra]
+		linkB := componentLink[rb]
+
+		var points []int
+		var children []*link
+		if linkA != nil {
+			points = append(points, linkA.points...)
+			children = append(children, linkA)
+		} else {
+			points = append(points, e.a)
+		}
+		if linkB != nil {
+			points = append(points, linkB.points...)
+			children = append(children, linkB)
+		} else {
+			points = append(points, e.b)
+		}
+
+		merged := &link{
+			id:       len(dendrogram) + 1,
+			distance: e.distance,
+			points:   points,
+			children: children,
+		}
+		dendrogram = append(dendrogram, merged)
+
+		uf.union(ra, rb)
+		componentLink[uf.find(ra)] = merged
+	}
+
+	return dendrogram
+}
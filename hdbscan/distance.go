@@ -0,0 +1,207 @@
+// Copyright 2020 Humility AI Incorporated, All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hdbscan
+
+import (
+	"fmt"
+	"math"
+)
+
+// DistanceFunc measures the distance between two points during clustering,
+// along with the metadata needed to decide which acceleration structures it
+// is safe to use and which data it is valid over.
+//
+// IsMetric must only be true when Func obeys the triangle inequality:
+// d(a,c) <= d(a,b) + d(b,c). Tree-based indexes such as VPTreeIndex rely on
+// that inequality to prune their search and produce incorrect results
+// without it.
+//
+// Bounded documents whether Func has a known maximum value (e.g. Jaccard
+// distance is bounded by 1); it is informational only and not currently
+// enforced by the package.
+//
+// Validate, if non-nil, checks that data lies within the domain Func
+// expects (dimensionality, value ranges, and so on). Run calls it before
+// clustering and returns its error rather than producing a meaningless
+// result.
+type DistanceFunc struct {
+	Name     string
+	Func     func(a, b []float64) float64
+	IsMetric bool
+	Bounded  bool
+	Validate func(data [][]float64) error
+}
+
+// EuclideanDistance is the standard L2 distance between two points. It is a
+// proper, unbounded metric and places no constraints on input data.
+var EuclideanDistance = DistanceFunc{
+	Name:     "euclidean",
+	Func:     euclideanDistance,
+	IsMetric: true,
+}
+
+func euclideanDistance(a, b []float64) float64 {
+	var sum float64
+	for i := range a {
+		d := a[i] - b[i]
+		sum += d * d
+	}
+	return math.Sqrt(sum)
+}
+
+// ManhattanDistance is the L1 (taxicab) distance between two points. It is a
+// proper, unbounded metric and places no constraints on input data.
+var ManhattanDistance = DistanceFunc{
+	Name:     "manhattan",
+	Func:     manhattanDistance,
+	IsMetric: true,
+}
+
+func manhattanDistance(a, b []float64) float64 {
+	var sum float64
+	for i := range a {
+		sum += math.Abs(a[i] - b[i])
+	}
+	return sum
+}
+
+// CosineDistance is 1 minus the cosine similarity of two vectors, commonly
+// used for text or embedding vectors where direction matters more than
+// magnitude. It does not obey the triangle inequality in general, so it is
+// not marked as a metric and cannot be paired with VPTreeIndex. It is
+// bounded to [0, 2]. The zero vector is defined to be maximally distant
+// (2) from everything, including itself.
+var CosineDistance = DistanceFunc{
+	Name:    "cosine",
+	Func:    cosineDistance,
+	Bounded: true,
+}
+
+func cosineDistance(a, b []float64) float64 {
+	var dot, normA, normB float64
+	for i := range a {
+		dot += a[i] * b[i]
+		normA += a[i] * a[i]
+		normB += b[i] * b[i]
+	}
+	if normA == 0 || normB == 0 {
+		return 2
+	}
+	return 1 - dot/(math.Sqrt(normA)*math.Sqrt(normB))
+}
+
+// earthRadiusKm is the mean radius of the Earth, used by HaversineDistance.
+const earthRadiusKm = 6371.0
+
+// HaversineDistance is the great-circle distance in kilometers between two
+// [latitude, longitude] points given in degrees. It is a proper metric and
+// is bounded by earthRadiusKm*pi (half the Earth's circumference). Points
+// must be 2-dimensional with latitude in [-90, 90] and longitude in
+// [-180, 180]; Validate enforces this.
+var HaversineDistance = DistanceFunc{
+	Name:     "haversine",
+	Func:     haversineDistance,
+	IsMetric: true,
+	Bounded:  true,
+	Validate: validateLatLon,
+}
+
+func haversineDistance(a, b []float64) float64 {
+	lat1, lon1 := a[0]*math.Pi/180, a[1]*math.Pi/180
+	lat2, lon2 := b[0]*math.Pi/180, b[1]*math.Pi/180
+
+	dLat := lat2 - lat1
+	dLon := lon2 - lon1
+
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(h))
+}
+
+func validateLatLon(data [][]float64) error {
+	for i, point := range data {
+		if len(point) != 2 {
+			return fmt.Errorf("point %d: haversine distance requires 2-D [latitude, longitude] points, got %d dimensions", i, len(point))
+		}
+		if point[0] < -90 || point[0] > 90 {
+			return fmt.Errorf("point %d: latitude %v out of range [-90, 90]", i, point[0])
+		}
+		if point[1] < -180 || point[1] > 180 {
+			return fmt.Errorf("point %d: longitude %v out of range [-180, 180]", i, point[1])
+		}
+	}
+	return nil
+}
+
+// JaccardDistance is 1 minus the Jaccard similarity of two 0/1 vectors,
+// treating each vector as the indicator of a set membership. It is a proper
+// metric and is bounded to [0, 1]. Every coordinate of every point must be
+// exactly 0 or 1; Validate enforces this. Two all-zero vectors (empty sets)
+// are defined to be identical (distance 0).
+var JaccardDistance = DistanceFunc{
+	Name:     "jaccard",
+	Func:     jaccardDistance,
+	IsMetric: true,
+	Bounded:  true,
+	Validate: validateBinary,
+}
+
+func jaccardDistance(a, b []float64) float64 {
+	var intersection, union float64
+	for i := range a {
+		if a[i] != 0 || b[i] != 0 {
+			union++
+			if a[i] != 0 && b[i] != 0 {
+				intersection++
+			}
+		}
+	}
+	if union == 0 {
+		return 0
+	}
+	return 1 - intersection/union
+}
+
+func validateBinary(data [][]float64) error {
+	for i, point := range data {
+		for j, v := range point {
+			if v != 0 && v != 1 {
+				return fmt.Errorf("point %d, dimension %d: jaccard distance requires 0/1 values, got %v", i, j, v)
+			}
+		}
+	}
+	return nil
+}
+
+// distanceRegistry resolves a DistanceFunc.Name back to the DistanceFunc
+// itself, since a persisted model can only store the name: Load needs it to
+// restore Clustering.distanceFunc without requiring the caller to pass the
+// original function back in. Distance functions registered via WithDistance
+// are not added here, so models trained with a custom distance function
+// must be re-registered (see RegisterDistance) before they can be Loaded.
+var distanceRegistry = map[string]DistanceFunc{
+	EuclideanDistance.Name: EuclideanDistance,
+	ManhattanDistance.Name: ManhattanDistance,
+	CosineDistance.Name:    CosineDistance,
+	HaversineDistance.Name: HaversineDistance,
+	JaccardDistance.Name:   JaccardDistance,
+}
+
+// RegisterDistance makes a custom DistanceFunc resolvable by name, which is
+// required for Load to reconstruct a Clustering that was trained with it.
+// It is typically called once at program startup alongside WithDistance.
+func RegisterDistance(fn DistanceFunc) {
+	distanceRegistry[fn.Name] = fn
+}
@@ -0,0 +1,355 @@
+// Copyright 2020 Humility AI Incorporated, All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hdbscan
+
+import "sort"
+
+// edge is a single mutual-reachability link between two points.
+type edge struct {
+	a, b     int
+	distance float64
+}
+
+// coreDistance is the distance from point i to its minimumClusterSize-th
+// nearest neighbor, i.e. how "dense" its neighborhood is. When an
+// HNSWIndex or VPTreeIndex has been built it is used in place of the
+// brute-force pairwise scan below, with HNSW taking priority since it is
+// the one meant for the largest data sets.
+func (c *Clustering) coreDistance(i int) float64 {
+	if c.hnswGraph != nil {
+		neighbors := c.hnswGraph.SearchExcluding(c.data[i], c.minimumClusterSize, c.hnswEfSearch, func(id int) bool {
+			return id == i
+		})
+		if len(neighbors) == 0 {
+			return 0
+		}
+		return neighbors[len(neighbors)-1].Distance
+	}
+
+	if c.vpTree != nil {
+		neighbors := c.vpTree.kNearest(c.data[i], c.minimumClusterSize, i)
+		if len(neighbors) == 0 {
+			return 0
+		}
+		return neighbors[len(neighbors)-1].distance
+	}
+
+	distances := make([]float64, 0, len(c.data)-1)
+	for j := range c.data {
+		if i == j {
+			continue
+		}
+		distances = append(distances, c.distanceFunc.Func(c.data[i], c.data[j]))
+	}
+	sort.Float64s(distances)
+
+	k := c.minimumClusterSize - 1
+	if k >= len(distances) {
+		k = len(distances) - 1
+	}
+	if k < 0 {
+		return 0
+	}
+	return distances[k]
+}
+
+// mutualReachabilityDistance is the standard HDBSCAN core-distance-aware
+// distance: max(core(a), core(b), d(a,b)).
+func (c *Clustering) mutualReachabilityDistance(i, j int, coreDistances []float64) float64 {
+	d := c.distanceFunc.Func(c.data[i], c.data[j])
+	if coreDistances[i] > d {
+		d = coreDistances[i]
+	}
+	if coreDistances[j] > d {
+		d = coreDistances[j]
+	}
+	return d
+}
+
+// mutualReachabilityGraph returns the edges that single-linkage clustering
+// should process, sorted in ascending order of mutual reachability distance.
+//
+// When an HNSWIndex or VPTreeIndex has been built, a spanning tree is always
+// returned (via hnswBoruvkaMST or boruvkaMST), whatever c.minTree says.
+// Otherwise, when c.minTree is set the graph is reduced to a minimum
+// spanning tree (via Prim's algorithm) before being returned, which is
+// sufficient to reproduce the same dendrogram as the complete graph at a
+// fraction of the memory, and when it is not the complete pairwise graph is
+// returned.
+func (c *Clustering) mutualReachabilityGraph() []edge {
+	n := len(c.data)
+	coreDistances := make([]float64, n)
+	for i := range c.data {
+		coreDistances[i] = c.coreDistance(i)
+	}
+
+	if c.hnswGraph != nil {
+		return c.hnswBoruvkaMST(coreDistances)
+	}
+
+	if c.vpTree != nil {
+		return c.boruvkaMST(coreDistances)
+	}
+
+	if c.minTree {
+		return c.primMST(coreDistances)
+	}
+
+	edges := make([]edge, 0, n*(n-1)/2)
+	for i := 0; i < n; i++ {
+		for j := i + 1; j < n; j++ {
+			edges = append(edges, edge{a: i, b: j, distance: c.mutualReachabilityDistance(i, j, coreDistances)})
+		}
+	}
+	sort.Slice(edges, func(i, j int) bool {
+		return edges[i].distance < edges[j].distance
+	})
+	return edges
+}
+
+// boruvkaMST builds a minimum spanning tree of the mutual reachability
+// graph using Boruvka's algorithm: on every round, each component finds its
+// cheapest outgoing edge via a VP-tree query (instead of scanning every
+// other point), and all such edges are contracted simultaneously. Every
+// round at least halves the number of components, so this turns the O(n^2)
+// pairwise scan of primMST into O(log n) rounds of n tree queries each, at
+// the cost of requiring a metric distance function.
+func (c *Clustering) boruvkaMST(coreDistances []float64) []edge {
+	n := len(c.data)
+	if n == 0 {
+		return nil
+	}
+
+	uf := newUnionFind(n)
+	edges := make([]edge, 0, n-1)
+	components := n
+
+	for components > 1 {
+		type candidate struct {
+			edge edge
+		}
+		bestByComponent := make(map[int]candidate, components)
+
+		for i := 0; i < n; i++ {
+			root := uf.find(i)
+			nearest, ok := c.vpTree.nearestMRDExcluding(i, coreDistances, func(point int) bool {
+				return uf.find(point) == root
+			})
+			if !ok {
+				continue
+			}
+
+			e := edge{a: i, b: nearest.point, distance: nearest.distance}
+			if cur, exists := bestByComponent[root]; !exists || e.distance < cur.edge.distance {
+				bestByComponent[root] = candidate{edge: e}
+			}
+		}
+
+		for _, cand := range bestByComponent {
+			ra, rb := uf.find(cand.edge.a), uf.find(cand.edge.b)
+			if ra == rb {
+				continue
+			}
+			uf.union(ra, rb)
+			edges = append(edges, cand.edge)
+			components--
+		}
+	}
+
+	sort.Slice(edges, func(i, j int) bool {
+		return edges[i].distance < edges[j].distance
+	})
+	return edges
+}
+
+// hnswBoruvkaMST is the HNSW-backed counterpart to boruvkaMST. Because HNSW
+// queries are approximate, a round can occasionally fail to find any
+// cross-component edge even though one exists; when that happens a single
+// brute-force round is used to guarantee the algorithm still terminates in
+// a spanning tree.
+func (c *Clustering) hnswBoruvkaMST(coreDistances []float64) []edge {
+	n := len(c.data)
+	if n == 0 {
+		return nil
+	}
+
+	uf := newUnionFind(n)
+	edges := make([]edge, 0, n-1)
+	components := n
+
+	for components > 1 {
+		type candidate struct {
+			edge edge
+		}
+		bestByComponent := make(map[int]candidate, components)
+
+		for i := 0; i < n; i++ {
+			root := uf.find(i)
+			neighbors := c.hnswGraph.SearchExcluding(c.data[i], 1, c.hnswEfSearch, func(id int) bool {
+				return uf.find(id) == root
+			})
+			if len(neighbors) == 0 {
+				continue
+			}
+
+			d := c.mutualReachabilityDistance(i, neighbors[0].ID, coreDistances)
+			e := edge{a: i, b: neighbors[0].ID, distance: d}
+			if cur, exists := bestByComponent[root]; !exists || e.distance < cur.edge.distance {
+				bestByComponent[root] = candidate{edge: e}
+			}
+		}
+
+		progressed := false
+		for _, cand := range bestByComponent {
+			ra, rb := uf.find(cand.edge.a), uf.find(cand.edge.b)
+			if ra == rb {
+				continue
+			}
+			uf.union(ra, rb)
+			edges = append(edges, cand.edge)
+			components--
+			progressed = true
+		}
+
+		if !progressed {
+			if e, ok := c.bruteForceComponentEdge(coreDistances, uf); ok {
+				uf.union(uf.find(e.a), uf.find(e.b))
+				edges = append(edges, e)
+				components--
+			} else {
+				break
+			}
+		}
+	}
+
+	sort.Slice(edges, func(i, j int) bool {
+		return edges[i].distance < edges[j].distance
+	})
+	return edges
+}
+
+// bruteForceComponentEdge scans every pair of points in different
+// components and returns the cheapest cross-component edge. It exists only
+// as a fallback for when an approximate index fails to surface any
+// cross-component candidate.
+func (c *Clustering) bruteForceComponentEdge(coreDistances []float64, uf *unionFind) (edge, bool) {
+	n := len(c.data)
+	best := edge{}
+	found := false
+	for i := 0; i < n; i++ {
+		for j := i + 1; j < n; j++ {
+			if uf.find(i) == uf.find(j) {
+				continue
+			}
+			d := c.mutualReachabilityDistance(i, j, coreDistances)
+			if !found || d < best.distance {
+				best = edge{a: i, b: j, distance: d}
+				found = true
+			}
+		}
+	}
+	return best, found
+}
+
+// primMST builds a minimum spanning tree of the mutual reachability graph
+// without ever materializing the full O(n^2) edge list.
+func (c *Clustering) primMST(coreDistances []float64) []edge {
+	n := len(c.data)
+	if n == 0 {
+		return nil
+	}
+
+	inTree := make([]bool, n)
+	minDistance := make([]float64, n)
+	nearest := make([]int, n)
+	for i := range minDistance {
+		minDistance[i] = -1
+	}
+
+	inTree[0] = true
+	for j := 1; j < n; j++ {
+		minDistance[j] = c.mutualReachabilityDistance(0, j, coreDistances)
+		nearest[j] = 0
+	}
+
+	edges := make([]edge, 0, n-1)
+	for k := 1; k < n; k++ {
+		next := -1
+		for j := 0; j < n; j++ {
+			if inTree[j] {
+				continue
+			}
+			if next == -1 || minDistance[j] < minDistance[next] {
+				next = j
+			}
+		}
+
+		inTree[next] = true
+		edges = append(edges, edge{a: nearest[next], b: next, distance: minDistance[next]})
+
+		for j := 0; j < n; j++ {
+			if inTree[j] {
+				continue
+			}
+			d := c.mutualReachabilityDistance(next, j, coreDistances)
+			if minDistance[j] == -1 || d < minDistance[j] {
+				minDistance[j] = d
+				nearest[j] = next
+			}
+		}
+	}
+
+	sort.Slice(edges, func(i, j int) bool {
+		return edges[i].distance < edges[j].distance
+	})
+	return edges
+}
+
+// unionFind is a disjoint-set structure used to merge components while
+// walking a sorted edge list during dendrogram construction.
+type unionFind struct {
+	parent []int
+	rank   []int
+}
+
+func newUnionFind(n int) *unionFind {
+	parent := make([]int, n)
+	for i := range parent {
+		parent[i] = i
+	}
+	return &unionFind{parent: parent, rank: make([]int, n)}
+}
+
+func (u *unionFind) find(i int) int {
+	for u.parent[i] != i {
+		u.parent[i] = u.parent[u.parent[i]]
+		i = u.parent[i]
+	}
+	return i
+}
+
+func (u *unionFind) union(i, j int) {
+	ri, rj := u.find(i), u.find(j)
+	if ri == rj {
+		return
+	}
+	if u.rank[ri] < u.rank[rj] {
+		ri, rj = rj, ri
+	}
+	u.parent[rj] = ri
+	if u.rank[ri] == u.rank[rj] {
+		u.rank[ri]++
+	}
+}
@@ -0,0 +1,170 @@
+// Copyright 2020 Humility AI Incorporated, All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hdbscan
+
+import (
+	"encoding/gob"
+	"fmt"
+	"io"
+
+	"github.com/golang/snappy"
+)
+
+// modelVersion is bumped whenever the persisted format changes in a way
+// that isn't backward compatible. Load rejects any version it doesn't
+// recognize rather than guessing at a layout.
+const modelVersion = 1
+
+// persistedCluster is the on-disk representation of a Cluster. Point and
+// Outlier member vectors are stored directly (rather than indices into the
+// original data) so that a loaded Clustering is fully self-contained.
+type persistedCluster struct {
+	ID       int
+	Centroid []float64
+	Points   [][]float64
+	Outliers [][]float64
+	Score    float64
+	Variance float64
+}
+
+// persistedModel is the gob-encoded, snappy-compressed payload written by
+// Save and read back by Load.
+type persistedModel struct {
+	Version            int
+	MinimumClusterSize int
+	DistanceName       string
+	NearestNeighbor    bool
+	OutlierClustering  bool
+	Voronoi            bool
+	VPTreeIndex        bool
+	HNSWIndex          bool
+	HNSWM              int
+	HNSWEfConstruction int
+	HNSWEfSearch       int
+	Clusters           []persistedCluster
+}
+
+// Save writes a trained Clustering to w as gob framing wrapped in snappy
+// compression. Only the information needed to later Assign new points is
+// kept: per-cluster centroids, member and outlier point vectors, and
+// scores. The original training data is not retained. The minimum
+// spanning tree edges and the dendrogram built from them during Run are
+// intentionally omitted: both are consumed once to produce the final flat
+// Clusters, and Assign and NearestNeighbor operate on that flat result, so
+// persisting the tree would only add space without adding capability.
+func (c *Clustering) Save(w io.Writer) error {
+	if len(c.Clusters) == 0 {
+		return fmt.Errorf("hdbscan: cannot save a Clustering that has not been Run")
+	}
+
+	model := persistedModel{
+		Version:            modelVersion,
+		MinimumClusterSize: c.minimumClusterSize,
+		DistanceName:       c.distanceFunc.Name,
+		NearestNeighbor:    c.nearestNeighbor,
+		OutlierClustering:  c.outlierClustering,
+		Voronoi:            c.voronoi,
+		VPTreeIndex:        c.vpTreeIndex,
+		HNSWIndex:          c.hnswIndex,
+		HNSWM:              c.hnswM,
+		HNSWEfConstruction: c.hnswEfConstruction,
+		HNSWEfSearch:       c.hnswEfSearch,
+	}
+
+	for _, cluster := range c.Clusters {
+		pc := persistedCluster{
+			ID:       cluster.id,
+			Centroid: cluster.Centroid,
+			Score:    cluster.score,
+			Variance: cluster.variance,
+		}
+		for _, p := range cluster.Points {
+			pc.Points = append(pc.Points, c.data[p])
+		}
+		for _, p := range cluster.Outliers {
+			pc.Outliers = append(pc.Outliers, c.data[p])
+		}
+		model.Clusters = append(model.Clusters, pc)
+	}
+
+	compressed := snappy.NewBufferedWriter(w)
+	if err := gob.NewEncoder(compressed).Encode(model); err != nil {
+		return fmt.Errorf("hdbscan: encoding model: %w", err)
+	}
+	return compressed.Close()
+}
+
+// Load reads a Clustering previously written by Save. The returned
+// Clustering supports Assign and NearestNeighbor end-to-end: it rebuilds a
+// synthetic data set from the stored cluster member vectors and, if the
+// original Clustering had VPTreeIndex or HNSWIndex configured, rebuilds
+// that index over the restored data so assignByNearestNeighbor can use it
+// to accelerate lookups instead of falling back to a brute-force scan.
+func Load(r io.Reader) (*Clustering, error) {
+	var model persistedModel
+	if err := gob.NewDecoder(snappy.NewReader(r)).Decode(&model); err != nil {
+		return nil, fmt.Errorf("hdbscan: decoding model: %w", err)
+	}
+	if model.Version != modelVersion {
+		return nil, fmt.Errorf("hdbscan: unsupported model version %d (want %d)", model.Version, modelVersion)
+	}
+
+	distanceFunc, ok := distanceRegistry[model.DistanceName]
+	if !ok {
+		return nil, fmt.Errorf("hdbscan: unknown distance function %q; register it before loading", model.DistanceName)
+	}
+
+	c := &Clustering{
+		minimumClusterSize: model.MinimumClusterSize,
+		distanceFunc:       distanceFunc,
+		nearestNeighbor:    model.NearestNeighbor,
+		outlierClustering:  model.OutlierClustering,
+		voronoi:            model.Voronoi,
+		vpTreeIndex:        model.VPTreeIndex,
+		hnswIndex:          model.HNSWIndex,
+		hnswM:              model.HNSWM,
+		hnswEfConstruction: model.HNSWEfConstruction,
+		hnswEfSearch:       model.HNSWEfSearch,
+	}
+
+	for _, pc := range model.Clusters {
+		cluster := &Cluster{
+			id:       pc.ID,
+			Centroid: pc.Centroid,
+			score:    pc.Score,
+			variance: pc.Variance,
+		}
+
+		for _, point := range pc.Points {
+			cluster.Points = append(cluster.Points, len(c.data))
+			c.data = append(c.data, point)
+		}
+		for _, point := range pc.Outliers {
+			cluster.Outliers = append(cluster.Outliers, len(c.data))
+			c.data = append(c.data, point)
+		}
+
+		c.Clusters = append(c.Clusters, cluster)
+	}
+
+	if c.vpTreeIndex {
+		c.vpTree = newVPTree(c.data, c.distanceFunc)
+	}
+	if c.hnswIndex {
+		c.hnswGraph = newHNSWGraph(c)
+	}
+
+	return c, nil
+}
@@ -0,0 +1,49 @@
+// Copyright 2020 Humility AI Incorporated, All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hdbscan
+
+// ClusterScore ranks the quality of a candidate cluster so that
+// selectOptimalClustering can decide whether two clusters are better
+// merged into one. It returns the score (higher is better) along with the
+// variance that produced it.
+type ClusterScore func(points []int, data [][]float64, distanceFunc DistanceFunc) (score, variance float64)
+
+// VarianceScore scores a cluster as 1/(1+v), where v is its average squared
+// distance to its own centroid: tight, low-variance clusters score high.
+func VarianceScore(points []int, data [][]float64, distanceFunc DistanceFunc) (score, variance float64) {
+	if len(points) == 0 {
+		return 0, 0
+	}
+
+	dimensions := len(data[points[0]])
+	centroid := make([]float64, dimensions)
+	for _, p := range points {
+		for i, v := range data[p] {
+			centroid[i] += v
+		}
+	}
+	for i := range centroid {
+		centroid[i] /= float64(len(points))
+	}
+
+	for _, p := range points {
+		d := distanceFunc.Func(data[p], centroid)
+		variance += d * d
+	}
+	variance /= float64(len(points))
+
+	score = 1 / (1 + variance)
+	return score, variance
+}
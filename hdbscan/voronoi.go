@@ -0,0 +1,49 @@
+// Copyright 2020 Humility AI Incorporated, All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hdbscan
+
+// clusterCentroids computes and stores the centroid of every cluster,
+// which Assign uses when Voronoi-based assignment is enabled.
+func (c *Clustering) clusterCentroids() {
+	for _, cluster := range c.Clusters {
+		cluster.Centroid = centroidOf(cluster.Points, c.data)
+	}
+}
+
+// outliersAndVoronoi reassigns every cluster's outliers to whichever
+// cluster's centroid is closest, which is the natural outlier handling
+// policy once Voronoi regions are available.
+func (c *Clustering) outliersAndVoronoi() {
+	if len(c.Clusters) == 0 {
+		return
+	}
+
+	for _, cluster := range c.Clusters {
+		outliers := cluster.Outliers
+		cluster.Outliers = nil
+		for _, p := range outliers {
+			best := c.Clusters[0]
+			bestDistance := c.distanceFunc.Func(c.data[p], best.Centroid)
+			for _, candidate := range c.Clusters[1:] {
+				d := c.distanceFunc.Func(c.data[p], candidate.Centroid)
+				if d < bestDistance {
+					best = candidate
+					bestDistance = d
+				}
+			}
+			best.Points = append(best.Points, p)
+		}
+	}
+}
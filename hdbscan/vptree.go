@@ -0,0 +1,242 @@
+// Copyright 2020 Humility AI Incorporated, All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hdbscan
+
+import (
+	"container/heap"
+	"math/rand"
+	"sort"
+)
+
+// vpNode is a single node of a vantage-point tree: a chosen point p and the
+// median distance mu that splits the remaining points into an inner set
+// (distance to p <= mu) and an outer set (distance to p > mu).
+type vpNode struct {
+	point        int
+	mu           float64
+	inner, outer *vpNode
+}
+
+// vpTree is a vantage-point tree over a fixed data set, used to accelerate
+// k-nearest-neighbor queries for metric distance functions. It must only be
+// built with a DistanceFunc whose IsMetric field is true: pruning relies on
+// the triangle inequality holding.
+type vpTree struct {
+	root         *vpNode
+	data         [][]float64
+	distanceFunc DistanceFunc
+	rng          *rand.Rand
+}
+
+// newVPTree builds a vantage-point tree over the given data. A local,
+// fixed-seed random source is used to pick vantage points so that Run
+// remains reproducible across calls.
+func newVPTree(data [][]float64, distanceFunc DistanceFunc) *vpTree {
+	t := &vpTree{
+		data:         data,
+		distanceFunc: distanceFunc,
+		rng:          rand.New(rand.NewSource(int64(len(data)))),
+	}
+
+	indices := make([]int, len(data))
+	for i := range indices {
+		indices[i] = i
+	}
+	t.root = t.build(indices)
+	return t
+}
+
+func (t *vpTree) build(indices []int) *vpNode {
+	if len(indices) == 0 {
+		return nil
+	}
+	if len(indices) == 1 {
+		return &vpNode{point: indices[0]}
+	}
+
+	pivotPos := t.rng.Intn(len(indices))
+	vantage := indices[pivotPos]
+	rest := append(append([]int(nil), indices[:pivotPos]...), indices[pivotPos+1:]...)
+
+	distances := make([]float64, len(rest))
+	for i, idx := range rest {
+		distances[i] = t.distanceFunc.Func(t.data[vantage], t.data[idx])
+	}
+
+	order := make([]int, len(rest))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(a, b int) bool { return distances[order[a]] < distances[order[b]] })
+
+	median := len(order) / 2
+	if median == 0 {
+		median = 1
+	}
+	mu := distances[order[median-1]]
+
+	var inner, outer []int
+	for _, pos := range order {
+		if distances[pos] <= mu {
+			inner = append(inner, rest[pos])
+		} else {
+			outer = append(outer, rest[pos])
+		}
+	}
+
+	return &vpNode{
+		point: vantage,
+		mu:    mu,
+		inner: t.build(inner),
+		outer: t.build(outer),
+	}
+}
+
+// neighbor is a single result of a vpTree query.
+type neighbor struct {
+	point    int
+	distance float64
+}
+
+// neighborHeap is a max-heap ordered by distance, so that the single
+// farthest of the current best k candidates sits at the top and can be
+// evicted in O(log k).
+type neighborHeap []neighbor
+
+func (h neighborHeap) Len() int            { return len(h) }
+func (h neighborHeap) Less(i, j int) bool  { return h[i].distance > h[j].distance }
+func (h neighborHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *neighborHeap) Push(x interface{}) { *h = append(*h, x.(neighbor)) }
+func (h *neighborHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	*h = old[:n-1]
+	return item
+}
+
+// kNearest returns the k nearest points to query (excluding the point
+// itself, identified by selfIndex; pass -1 if query is not one of the
+// tree's own points), sorted in ascending order of distance.
+func (t *vpTree) kNearest(query []float64, k int, selfIndex int) []neighbor {
+	if k <= 0 || t.root == nil {
+		return nil
+	}
+
+	best := &neighborHeap{}
+	heap.Init(best)
+	tau := float64(-1)
+
+	var search func(n *vpNode)
+	search = func(n *vpNode) {
+		if n == nil {
+			return
+		}
+
+		if n.point != selfIndex {
+			d := t.distanceFunc.Func(query, t.data[n.point])
+			if best.Len() < k {
+				heap.Push(best, neighbor{point: n.point, distance: d})
+				if best.Len() == k {
+					tau = (*best)[0].distance
+				}
+			} else if d < tau {
+				heap.Pop(best)
+				heap.Push(best, neighbor{point: n.point, distance: d})
+				tau = (*best)[0].distance
+			}
+		}
+
+		if n.inner == nil && n.outer == nil {
+			return
+		}
+
+		d := t.distanceFunc.Func(query, t.data[n.point])
+		first, second := n.inner, n.outer
+		if d >= n.mu {
+			first, second = n.outer, n.inner
+		}
+
+		search(first)
+		if tau < 0 || absFloat(d-n.mu) < tau {
+			search(second)
+		}
+	}
+	search(t.root)
+
+	results := make([]neighbor, best.Len())
+	copy(results, *best)
+	sort.Slice(results, func(i, j int) bool { return results[i].distance < results[j].distance })
+	return results
+}
+
+// nearestMRDExcluding returns the point with the smallest mutual
+// reachability distance to queryIdx among those for which exclude returns
+// false, or ok=false if every point is excluded. Since mutual reachability
+// distance is never smaller than the underlying metric distance, pruning
+// against it is always conservative: the search may visit a few more nodes
+// than a raw nearest-neighbor query would, but never misses the true
+// nearest reachability neighbor.
+func (t *vpTree) nearestMRDExcluding(queryIdx int, coreDistances []float64, exclude func(point int) bool) (result neighbor, ok bool) {
+	query := t.data[queryIdx]
+	tau := float64(-1)
+
+	var search func(n *vpNode)
+	search = func(n *vpNode) {
+		if n == nil {
+			return
+		}
+
+		d := t.distanceFunc.Func(query, t.data[n.point])
+
+		if !exclude(n.point) {
+			mrd := d
+			if coreDistances[queryIdx] > mrd {
+				mrd = coreDistances[queryIdx]
+			}
+			if coreDistances[n.point] > mrd {
+				mrd = coreDistances[n.point]
+			}
+			if !ok || mrd < tau {
+				result = neighbor{point: n.point, distance: mrd}
+				tau = mrd
+				ok = true
+			}
+		}
+
+		if n.inner == nil && n.outer == nil {
+			return
+		}
+
+		first, second := n.inner, n.outer
+		if d >= n.mu {
+			first, second = n.outer, n.inner
+		}
+
+		search(first)
+		if !ok || absFloat(d-n.mu) < tau {
+			search(second)
+		}
+	}
+	search(t.root)
+	return result, ok
+}
+
+func absFloat(f float64) float64 {
+	if f < 0 {
+		return -f
+	}
+	return f
+}
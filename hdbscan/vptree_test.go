@@ -0,0 +1,112 @@
+// Copyright 2020 Humility AI Incorporated, All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hdbscan
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func randomVPTreeData(n, dim int, seed int64) [][]float64 {
+	rng := rand.New(rand.NewSource(seed))
+	data := make([][]float64, n)
+	for i := range data {
+		point := make([]float64, dim)
+		for j := range point {
+			point[j] = rng.Float64() * 100
+		}
+		data[i] = point
+	}
+	return data
+}
+
+// bruteForceKNearest mirrors kNearest's contract (k nearest to query,
+// excluding selfIndex, ascending order) by exhaustive search.
+func bruteForceKNearest(data [][]float64, distanceFunc DistanceFunc, query []float64, k, selfIndex int) []neighbor {
+	var all []neighbor
+	for i, point := range data {
+		if i == selfIndex {
+			continue
+		}
+		all = append(all, neighbor{point: i, distance: distanceFunc.Func(query, point)})
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].distance < all[j].distance })
+	if len(all) > k {
+		all = all[:k]
+	}
+	return all
+}
+
+func TestVPTreeKNearestMatchesBruteForce(t *testing.T) {
+	data := randomVPTreeData(200, 5, 1)
+	tree := newVPTree(data, EuclideanDistance)
+
+	for i, query := range data {
+		got := tree.kNearest(query, 10, i)
+		want := bruteForceKNearest(data, EuclideanDistance, query, 10, i)
+
+		if len(got) != len(want) {
+			t.Fatalf("point %d: got %d neighbors, want %d", i, len(got), len(want))
+		}
+		for j := range want {
+			if got[j].point != want[j].point || got[j].distance != want[j].distance {
+				t.Errorf("point %d, rank %d: got %+v, want %+v", i, j, got[j], want[j])
+			}
+		}
+	}
+}
+
+func TestVPTreeKNearestKLargerThanTree(t *testing.T) {
+	data := randomVPTreeData(5, 3, 2)
+	tree := newVPTree(data, EuclideanDistance)
+
+	got := tree.kNearest(data[0], 100, 0)
+	if len(got) != len(data)-1 {
+		t.Fatalf("got %d neighbors, want %d", len(got), len(data)-1)
+	}
+}
+
+func TestBoruvkaMSTWeightMatchesPrimMST(t *testing.T) {
+	data := randomVPTreeData(200, 4, 3)
+
+	c := &Clustering{data: data, distanceFunc: EuclideanDistance, minimumClusterSize: minimumClusterSize}
+	coreDistances := make([]float64, len(data))
+	for i := range data {
+		coreDistances[i] = c.coreDistance(i)
+	}
+
+	primEdges := c.primMST(coreDistances)
+
+	c.vpTree = newVPTree(data, EuclideanDistance)
+	boruvkaEdges := c.boruvkaMST(coreDistances)
+
+	if len(primEdges) != len(boruvkaEdges) {
+		t.Fatalf("boruvkaMST produced %d edges, want %d", len(boruvkaEdges), len(primEdges))
+	}
+
+	var primWeight, boruvkaWeight float64
+	for _, e := range primEdges {
+		primWeight += e.distance
+	}
+	for _, e := range boruvkaEdges {
+		boruvkaWeight += e.distance
+	}
+
+	const tolerance = 1e-9
+	if diff := primWeight - boruvkaWeight; diff > tolerance || diff < -tolerance {
+		t.Errorf("boruvkaMST weight = %v, primMST weight = %v", boruvkaWeight, primWeight)
+	}
+}
@@ -0,0 +1,329 @@
+// Copyright 2020 Humility AI Incorporated, All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package hnsw implements a Hierarchical Navigable Small World graph: an
+// approximate nearest-neighbor index that trades a small amount of recall
+// for query times that scale far better than brute-force or even
+// tree-based exact search on large or high-dimensional data sets.
+//
+// Results from Search are approximate: recall can be tuned up (at the cost
+// of speed) by raising M, EfConstruction and the ef passed to Search.
+package hnsw
+
+import (
+	"container/heap"
+	"math"
+	"math/rand"
+)
+
+// DistanceFunc measures the distance between two vectors.
+type DistanceFunc func(a, b []float64) float64
+
+// Neighbor is a single result returned by Search.
+type Neighbor struct {
+	ID       int
+	Distance float64
+}
+
+type node struct {
+	id        int
+	vector    []float64
+	neighbors [][]int // neighbors[level] = neighbor ids at that level
+}
+
+// Graph is an HNSW index. M controls the maximum number of connections per
+// node per layer (2*M on layer 0), EfConstruction controls the beam width
+// used while inserting, and both trade index build time and memory for
+// recall.
+type Graph struct {
+	M              int
+	Mmax           int
+	Mmax0          int
+	EfConstruction int
+	mL             float64
+	distanceFunc   DistanceFunc
+	rng            *rand.Rand
+
+	nodes      map[int]*node
+	entryPoint int
+	hasEntry   bool
+}
+
+// New creates an empty HNSW graph. m is the base per-layer connectivity
+// (commonly 5-48) and efConstruction is the insertion beam width (commonly
+// >= m).
+func New(m, efConstruction int, distanceFunc DistanceFunc) *Graph {
+	if m < 1 {
+		m = 1
+	}
+	return &Graph{
+		M:              m,
+		Mmax:           m,
+		Mmax0:          2 * m,
+		EfConstruction: efConstruction,
+		mL:             1 / math.Log(float64(m+1)),
+		distanceFunc:   distanceFunc,
+		rng:            rand.New(rand.NewSource(int64(m)*1_000_003 + int64(efConstruction))),
+		nodes:          make(map[int]*node),
+	}
+}
+
+func (g *Graph) randomLevel() int {
+	return int(math.Floor(-math.Log(g.rng.Float64()) * g.mL))
+}
+
+// Insert adds a new point with the given id to the graph. id must be
+// unique; vector is retained by reference.
+func (g *Graph) Insert(id int, vector []float64) {
+	level := g.randomLevel()
+	n := &node{id: id, vector: vector, neighbors: make([][]int, level+1)}
+	g.nodes[id] = n
+
+	if !g.hasEntry {
+		g.entryPoint = id
+		g.hasEntry = true
+		return
+	}
+
+	entry := g.entryPoint
+	entryLevel := len(g.nodes[entry].neighbors) - 1
+
+	// Greedily descend from the top layer down to level+1, tracking only
+	// the single closest point found so far on each layer.
+	current := entry
+	currentDist := g.distanceFunc(vector, g.nodes[current].vector)
+	for l := entryLevel; l > level; l-- {
+		improved := true
+		for improved {
+			improved = false
+			for _, candidate := range g.neighborsAt(current, l) {
+				d := g.distanceFunc(vector, g.nodes[candidate].vector)
+				if d < currentDist {
+					current = candidate
+					currentDist = d
+					improved = true
+				}
+			}
+		}
+	}
+
+	// From min(level, entryLevel) down to 0, run a beam search and connect.
+	for l := min(level, entryLevel); l >= 0; l-- {
+		candidates := g.searchLayer(vector, current, g.EfConstruction, l)
+		maxConn := g.Mmax
+		if l == 0 {
+			maxConn = g.Mmax0
+		}
+		selected := g.selectNeighbors(vector, candidates, maxConn)
+
+		n.neighbors[l] = make([]int, len(selected))
+		for i, s := range selected {
+			n.neighbors[l][i] = s.ID
+		}
+
+		for _, s := range selected {
+			g.connect(s.ID, id, l, maxConn)
+		}
+
+		if len(candidates) > 0 {
+			current = candidates[0].ID
+		}
+	}
+
+	if level > entryLevel {
+		g.entryPoint = id
+	}
+}
+
+// connect adds b to a's neighbor list on layer l (Insert has already added
+// a to b's list, which makes the edge bidirectional), pruning a's neighbor
+// list back down to maxConn using the same diversity heuristic used during
+// insertion if it has grown too large.
+func (g *Graph) connect(a, b, l, maxConn int) {
+	na := g.nodes[a]
+	for len(na.neighbors) <= l {
+		na.neighbors = append(na.neighbors, nil)
+	}
+	na.neighbors[l] = append(na.neighbors[l], b)
+
+	if len(na.neighbors[l]) <= maxConn {
+		return
+	}
+
+	candidates := make([]Neighbor, len(na.neighbors[l]))
+	for i, id := range na.neighbors[l] {
+		candidates[i] = Neighbor{ID: id, Distance: g.distanceFunc(na.vector, g.nodes[id].vector)}
+	}
+	selected := g.selectNeighbors(na.vector, candidates, maxConn)
+
+	na.neighbors[l] = make([]int, len(selected))
+	for i, s := range selected {
+		na.neighbors[l][i] = s.ID
+	}
+}
+
+// selectNeighbors implements the diversity heuristic: candidates are
+// considered closest-first, and a candidate is rejected if any neighbor
+// already selected is closer to it than it is to the query. This avoids
+// clustering all of a node's edges in a single direction.
+func (g *Graph) selectNeighbors(query []float64, candidates []Neighbor, maxConn int) []Neighbor {
+	sorted := append([]Neighbor(nil), candidates...)
+	sortNeighbors(sorted)
+
+	var selected []Neighbor
+	for _, c := range sorted {
+		if len(selected) >= maxConn {
+			break
+		}
+
+		keep := true
+		for _, s := range selected {
+			if g.distanceFunc(g.nodes[s.ID].vector, g.nodes[c.ID].vector) < c.Distance {
+				keep = false
+				break
+			}
+		}
+		if keep {
+			selected = append(selected, c)
+		}
+	}
+	return selected
+}
+
+func (g *Graph) neighborsAt(id, level int) []int {
+	n := g.nodes[id]
+	if level >= len(n.neighbors) {
+		return nil
+	}
+	return n.neighbors[level]
+}
+
+// searchLayer runs a best-first beam search of width ef on a single layer,
+// starting from entry, and returns the candidates found sorted by
+// ascending distance.
+func (g *Graph) searchLayer(query []float64, entry int, ef, level int) []Neighbor {
+	visited := map[int]bool{entry: true}
+	entryDist := g.distanceFunc(query, g.nodes[entry].vector)
+
+	candidates := &minHeap{{ID: entry, Distance: entryDist}}
+	heap.Init(candidates)
+
+	results := &maxHeap{{ID: entry, Distance: entryDist}}
+	heap.Init(results)
+
+	for candidates.Len() > 0 {
+		nearest := heap.Pop(candidates).(Neighbor)
+		worst := (*results)[0]
+		if nearest.Distance > worst.Distance && results.Len() >= ef {
+			break
+		}
+
+		for _, neighborID := range g.neighborsAt(nearest.ID, level) {
+			if visited[neighborID] {
+				continue
+			}
+			visited[neighborID] = true
+
+			d := g.distanceFunc(query, g.nodes[neighborID].vector)
+			worst = (*results)[0]
+			if results.Len() < ef || d < worst.Distance {
+				heap.Push(candidates, Neighbor{ID: neighborID, Distance: d})
+				heap.Push(results, Neighbor{ID: neighborID, Distance: d})
+				if results.Len() > ef {
+					heap.Pop(results)
+				}
+			}
+		}
+	}
+
+	out := make([]Neighbor, results.Len())
+	copy(out, *results)
+	sortNeighbors(out)
+	return out
+}
+
+// Search returns the approximate k nearest neighbors of query, using a
+// beam search of width ef on the bottom layer (ef should be >= k; larger
+// values trade speed for recall).
+func (g *Graph) Search(query []float64, k, ef int) []Neighbor {
+	if !g.hasEntry {
+		return nil
+	}
+	if ef < k {
+		ef = k
+	}
+
+	entryLevel := len(g.nodes[g.entryPoint].neighbors) - 1
+	current := g.entryPoint
+	currentDist := g.distanceFunc(query, g.nodes[current].vector)
+	for l := entryLevel; l > 0; l-- {
+		improved := true
+		for improved {
+			improved = false
+			for _, candidate := range g.neighborsAt(current, l) {
+				d := g.distanceFunc(query, g.nodes[candidate].vector)
+				if d < currentDist {
+					current = candidate
+					currentDist = d
+					improved = true
+				}
+			}
+		}
+	}
+
+	results := g.searchLayer(query, current, ef, 0)
+	if len(results) > k {
+		results = results[:k]
+	}
+	return results
+}
+
+// SearchExcluding behaves like Search but skips any candidate id for which
+// exclude returns true, returning up to k matches. While fewer than k
+// non-excluded matches have been found it repeats the search with a wider
+// beam, for at most six passes (the last with 6*k results and 6*ef beam
+// width), stopping early once a pass returns every point of the graph; it
+// then returns the largest set of matches found, which may be fewer than k
+// or empty. This makes it suitable for component-aware queries such as
+// Boruvka MST construction.
+func (g *Graph) SearchExcluding(query []float64, k, ef int, exclude func(id int) bool) []Neighbor {
+	var best []Neighbor
+	for attempt := 0; attempt < 6; attempt++ {
+		results := g.Search(query, k+attempt*k, ef+attempt*ef)
+
+		var kept []Neighbor
+		for _, r := range results {
+			if !exclude(r.ID) {
+				kept = append(kept, r)
+				if len(kept) == k {
+					return kept
+				}
+			}
+		}
+		if len(kept) > len(best) {
+			best = kept
+		}
+		if len(results) >= len(g.nodes) {
+			return best
+		}
+	}
+	return best
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
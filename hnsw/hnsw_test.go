@@ -0,0 +1,165 @@
+// Copyright 2020 Humility AI Incorporated, All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package hnsw
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func euclidean(a, b []float64) float64 {
+	var sum float64
+	for i := range a {
+		d := a[i] - b[i]
+		sum += d * d
+	}
+	return math.Sqrt(sum)
+}
+
+func randomVectors(n, dim int, seed int64) [][]float64 {
+	rng := rand.New(rand.NewSource(seed))
+	vectors := make([][]float64, n)
+	for i := range vectors {
+		v := make([]float64, dim)
+		for j := range v {
+			v[j] = rng.Float64() * 100
+		}
+		vectors[i] = v
+	}
+	return vectors
+}
+
+func bruteForceKNN(vectors [][]float64, query []float64, k int) []int {
+	type hit struct {
+		id       int
+		distance float64
+	}
+	hits := make([]hit, len(vectors))
+	for i, v := range vectors {
+		hits[i] = hit{id: i, distance: euclidean(query, v)}
+	}
+	sort.Slice(hits, func(i, j int) bool { return hits[i].distance < hits[j].distance })
+	if len(hits) > k {
+		hits = hits[:k]
+	}
+	ids := make([]int, len(hits))
+	for i, h := range hits {
+		ids[i] = h.id
+	}
+	return ids
+}
+
+// TestGraphSearchRecall builds a graph over a few hundred random points and
+// checks that Search finds most of the true k nearest neighbors. Recall is
+// approximate by design, so the assertion is a lower bound rather than an
+// exact match, but a badly broken beam search or selectNeighbors heuristic
+// would fail it outright.
+func TestGraphSearchRecall(t *testing.T) {
+	const n, dim, k = 500, 8, 10
+	vectors := randomVectors(n, dim, 42)
+
+	g := New(16, 64, euclidean)
+	for i, v := range vectors {
+		g.Insert(i, v)
+	}
+
+	queries := randomVectors(20, dim, 99)
+	var hits, total int
+	for _, q := range queries {
+		want := bruteForceKNN(vectors, q, k)
+		wantSet := make(map[int]bool, len(want))
+		for _, id := range want {
+			wantSet[id] = true
+		}
+
+		got := g.Search(q, k, 128)
+		if len(got) != k {
+			t.Fatalf("Search returned %d results, want %d", len(got), k)
+		}
+		for _, n := range got {
+			if wantSet[n.ID] {
+				hits++
+			}
+		}
+		total += k
+	}
+
+	recall := float64(hits) / float64(total)
+	if recall < 0.8 {
+		t.Errorf("recall@%d = %.2f, want >= 0.80", k, recall)
+	}
+}
+
+func TestSearchExcludingAllExcluded(t *testing.T) {
+	vectors := randomVectors(50, 4, 1)
+	g := New(8, 32, euclidean)
+	for i, v := range vectors {
+		g.Insert(i, v)
+	}
+
+	got := g.SearchExcluding(vectors[0], 5, 16, func(id int) bool { return true })
+	if len(got) != 0 {
+		t.Errorf("got %d results with everything excluded, want 0", len(got))
+	}
+}
+
+func TestSearchExcludingEmptyGraph(t *testing.T) {
+	g := New(8, 32, euclidean)
+
+	if got := g.Search([]float64{0, 0}, 5, 16); got != nil {
+		t.Errorf("Search on empty graph = %v, want nil", got)
+	}
+	if got := g.SearchExcluding([]float64{0, 0}, 5, 16, func(id int) bool { return false }); len(got) != 0 {
+		t.Errorf("SearchExcluding on empty graph = %v, want empty", got)
+	}
+}
+
+func TestSearchExcludingKLargerThanGraph(t *testing.T) {
+	vectors := randomVectors(10, 4, 2)
+	g := New(8, 32, euclidean)
+	for i, v := range vectors {
+		g.Insert(i, v)
+	}
+
+	got := g.SearchExcluding(vectors[0], 100, 32, func(id int) bool { return false })
+	if len(got) != len(vectors) {
+		t.Errorf("got %d results, want all %d graph points", len(got), len(vectors))
+	}
+}
+
+func TestSearchExcludingPartial(t *testing.T) {
+	vectors := randomVectors(200, 4, 3)
+	g := New(8, 32, euclidean)
+	for i, v := range vectors {
+		g.Insert(i, v)
+	}
+
+	excluded := make(map[int]bool)
+	for i := 0; i < 190; i++ {
+		excluded[i] = true
+	}
+
+	got := g.SearchExcluding(vectors[0], 5, 16, func(id int) bool { return excluded[id] })
+	if len(got) == 0 {
+		t.Fatal("got no results with 10 non-excluded candidates available")
+	}
+	for _, n := range got {
+		if excluded[n.ID] {
+			t.Errorf("result %d is excluded", n.ID)
+		}
+	}
+}